@@ -4,7 +4,10 @@
 
 package gocog
 
-import "io"
+import (
+	"io"
+	"os"
+)
 
 // buffer buffers an io.Reader to satisfy io.ReaderAt.
 type buffer struct {
@@ -48,10 +51,17 @@ func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
 }
 
 // Slice returns a slice of the underlying buffer. The slice contains
-// n bytes starting at offset off.
+// n bytes starting at offset off, which may be anywhere in the data: the
+// buffer is filled up to it as needed.
 func (b *buffer) Slice(off, n int) ([]byte, error) {
 	end := off + n
+	if off < 0 || n < 0 || end < off {
+		return nil, io.ErrUnexpectedEOF
+	}
 	if err := b.fill(end); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
 	return b.buf[off:end], nil
@@ -67,3 +77,23 @@ func newReaderAt(r io.Reader) io.ReaderAt {
 		buf: make([]byte, 0, 1024),
 	}
 }
+
+// readerSize returns the size of the data behind ra, if it can be known
+// without reading it all.
+func readerSize(ra io.ReaderAt) (int64, bool) {
+	switch r := ra.(type) {
+	case *InstrumentedReaderAt:
+		return readerSize(r.ra)
+	case *headerReaderAt:
+		return readerSize(r.ra)
+	case interface{ Size() int64 }:
+		return r.Size(), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, false
+		}
+		return fi.Size(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package gocog
+
+import (
+	"image"
+	"log"
+	"math"
+	"math/bits"
+
+	"github.com/terrascope/scimage"
+)
+
+// ByteOrderSuspect tells whether the 16-bit samples of level look like they
+// were written in the opposite byte order to the one declared in the
+// header, as happens with some hand-edited files. It decodes the first
+// tile of the level and compares how much neighbouring samples differ when
+// read in each byte order: real data, unlike scrambled data, varies
+// smoothly. The check is a heuristic meant for debugging scrambled-looking
+// output. Levels of other sample sizes are never suspect.
+func (r *Reader) ByteOrderSuspect(level int) (bool, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return false, err
+	}
+	rects, err := r.d.tileRects(level)
+	if err != nil {
+		return false, err
+	}
+	tile, err := decodeLevelSubImage(r.d.perTile(), level, rects[0], 1, -1)
+	if err != nil {
+		return false, err
+	}
+
+	var declared, swapped func(x, y int) float64
+	switch img := tile.(type) {
+	case *scimage.GrayU16:
+		declared = func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }
+		swapped = func(x, y int) float64 { return float64(bits.ReverseBytes16(img.Pix[img.PixOffset(x, y)])) }
+	case *scimage.GrayS16:
+		declared = func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }
+		swapped = func(x, y int) float64 {
+			return float64(int16(bits.ReverseBytes16(uint16(img.Pix[img.PixOffset(x, y)]))))
+		}
+	default:
+		return false, nil
+	}
+
+	suspect := roughness(tile.Bounds(), swapped)*4 < roughness(tile.Bounds(), declared)
+	if suspect {
+		log.Printf("level %d: samples look smoother in the opposite byte order, the header may declare the wrong one", level)
+	}
+	return suspect, nil
+}
+
+// roughness returns the sum of the absolute differences between
+// horizontally adjacent samples within b.
+func roughness(b image.Rectangle, at func(x, y int) float64) float64 {
+	sum := 0.0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X + 1; x < b.Max.X; x++ {
+			sum += math.Abs(at(x, y) - at(x-1, y))
+		}
+	}
+	return sum
+}
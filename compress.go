@@ -6,19 +6,63 @@ package gocog
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"sync"
 )
 
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   = map[uint16]func(r io.Reader) io.ReadCloser{}
+)
+
+// RegisterDecompressor makes a decompressor available for tiles using the
+// Compression tag value code, typically from the init function of the
+// package providing the codec. It is only used for the compression schemes
+// this package does not handle itself, such as JPEG XL (52546), which is
+// left out to keep the package free of cgo:
+//
+//	gocog.RegisterDecompressor(52546, func(r io.Reader) io.ReadCloser {
+//		return jxl.NewTileReader(r)
+//	})
+//
+// where jxl stands for a binding to a JPEG XL library. The returned reader
+// must yield the samples of the tile as they would be stored uncompressed.
+func RegisterDecompressor(code uint16, fn func(r io.Reader) io.ReadCloser) {
+	decompressorsMu.Lock()
+	decompressors[code] = fn
+	decompressorsMu.Unlock()
+}
+
+// decompressor returns the decompressor registered for code, or nil.
+func decompressor(code uint16) func(r io.Reader) io.ReadCloser {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	return decompressors[code]
+}
+
 type byteReader interface {
 	io.Reader
 	io.ByteReader
 }
 
+// isZlib reports whether the data at offset in src starts with a zlib
+// header (RFC 1950): a deflate compression method and a check value making
+// the first two bytes a multiple of 31.
+func isZlib(src io.ReaderAt, offset int64) bool {
+	hdr := make([]byte, 2)
+	if _, err := src.ReadAt(hdr, offset); err != nil {
+		return false
+	}
+	return hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
+
 // unpackBits decodes the PackBits-compressed data in src and returns the
 // uncompressed data.
 //
 // The PackBits compression format is described in section 9 (p. 42)
-// of the TIFF spec.
+// of the TIFF spec. Data ending in the middle of a run is reported as a
+// FormatError.
 func unpackBits(r io.Reader) ([]byte, error) {
 	buf := make([]byte, 128)
 	dst := make([]byte, 0, 1024)
@@ -40,14 +84,14 @@ func unpackBits(r io.Reader) ([]byte, error) {
 		case code >= 0:
 			n, err := io.ReadFull(br, buf[:code+1])
 			if err != nil {
-				return nil, err
+				return nil, truncated(err)
 			}
 			dst = append(dst, buf[:n]...)
 		case code == -128:
 			// No-op.
 		default:
 			if b, err = br.ReadByte(); err != nil {
-				return nil, err
+				return nil, truncated(err)
 			}
 			for j := 0; j < 1-code; j++ {
 				buf[j] = b
@@ -56,3 +100,22 @@ func unpackBits(r io.Reader) ([]byte, error) {
 		}
 	}
 }
+
+// truncated turns the EOF errors of a read in the middle of a PackBits run
+// into a FormatError.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return FormatError("truncated PackBits run")
+	}
+	return err
+}
+
+// readAll reads r until EOF, like ioutil.ReadAll, into a buffer sized for
+// the expected size bytes, so decompressing a tile allocates once. There
+// is room to spare for the final read that finds EOF, and longer data is
+// still read in full.
+func readAll(r io.Reader, size int) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
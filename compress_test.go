@@ -0,0 +1,106 @@
+package gocog
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+// packBitsRows compresses each row of 16 samples of a 16 by 16 tile as
+// a literal run.
+func packBitsRows(tile []byte) []byte {
+	var out []byte
+	for y := 0; y < 16; y++ {
+		out = append(out, 15)
+		out = append(out, tile[16*y:16*(y+1)]...)
+	}
+	return out
+}
+
+func TestPackBitsTruncatedRun(t *testing.T) {
+	// The last literal run of the second tile lacks 10 of its 16 bytes.
+	file := compressedTIFF(32, 16, 16, 16, func(k int, tile []byte) []byte {
+		packed := packBitsRows(tile)
+		if k == 1 {
+			packed = packed[:len(packed)-10]
+		}
+		return packed
+	}, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cPackBits}})
+	// A replicate run may be cut after its header too.
+	if _, err := unpackBits(bytes.NewReader([]byte{0xfe})); err == nil {
+		t.Fatal("unpacked a replicate run without its byte")
+	}
+
+	r, err := NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.DecodeLevelSubImage(0, image.Rect(0, 0, 16, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 1, testSample)
+
+	_, err = r.DecodeLevel(0)
+	var fe FormatError
+	if !errors.As(err, &fe) || !strings.Contains(err.Error(), "tile 1") {
+		t.Fatalf("got %v, want a FormatError naming tile 1", err)
+	}
+}
+
+func TestDeflateStreams(t *testing.T) {
+	rawDeflate := func(tile []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		fw.Write(tile)
+		err = fw.Close()
+		return buf.Bytes(), err
+	}
+
+	for name, compress := range map[string]func([]byte) ([]byte, error){"zlib": deflateTile, "raw deflate": rawDeflate} {
+		var stored []byte
+		file := compressedTIFF(16, 16, 16, 16, func(k int, tile []byte) []byte {
+			var err error
+			if stored, err = compress(tile); err != nil {
+				t.Fatal(err)
+			}
+			return stored
+		}, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cDeflate}})
+		if got := isZlib(bytes.NewReader(file), int64(len(file)-len(stored))); got != (name == "zlib") {
+			t.Fatalf("%s: isZlib reports %v", name, got)
+		}
+		img, err := DecodeLevel(bytes.NewReader(file), 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+}
+
+func TestLZMA(t *testing.T) {
+	file := compressedTIFF(40, 30, 16, 16, func(k int, tile []byte) []byte {
+		var buf bytes.Buffer
+		xw, err := xz.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xw.Write(tile)
+		if err := xw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cLZMA}})
+	img, err := DecodeLevel(bytes.NewReader(file), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 1, testSample)
+}
@@ -36,10 +36,11 @@ const (
 	dtSRational = 10
 	dtFloat32   = 11
 	dtFloat64   = 12
+	dtIFD       = 13 // An offset to an IFD, as a LONG.
 )
 
 // The length of one instance of each data type in bytes.
-var lengths = [...]uint32{0, 1, 1, 2, 4, 8, 1, 0, 2, 4, 8, 4, 8}
+var lengths = [...]uint32{0, 1, 1, 2, 4, 8, 1, 0, 2, 4, 8, 4, 8, 4}
 
 const (
 	cNewSubfileType      = 254
@@ -48,16 +49,37 @@ const (
 	cBitsPerSample       = 258
 	cCompression         = 259
 	cPhotometricInterpr  = 262
+	cFillOrder           = 266
+	cDocumentName        = 269
+	cImageDescription    = 270
+	cStripOffsets        = 273
 	cSamplesPerPixel     = 277
+	cRowsPerStrip        = 278
+	cStripByteCounts     = 279
 	cPlanarConfiguration = 284
+	cPageName            = 285
+	cSoftware            = 305
+	cDateTime            = 306
 
 	cPredictor    = 317
+	cColorMap     = 320
 
 	cTileWidth           = 322
 	cTileLength          = 323
 	cTileOffsets         = 324
 	cTileByteCounts      = 325
+	cExtraSamples        = 338
 	cSampleFormat        = 339
+	cSMinSampleValue     = 340
+	cSMaxSampleValue     = 341
+
+	cSubIFDs = 330
+
+	cJPEGTables = 347
+
+	cYCbCrSubSampling    = 530
+	cYCbCrPositioning    = 531
+	cReferenceBlackWhite = 532
 )
 
 
@@ -217,8 +239,26 @@ const (
 	cDeflate    = 8 // zlib compression.
 	cPackBits   = 32773
 	cDeflateOld = 32946 // Superseded by cDeflate.
+	cLZMA       = 34925 // LZMA2 in an xz container, as written by libtiff.
+	cJPEGXL     = 52546 // As written by GDAL.
 )
 
+// compressionNames names the compression types for error messages.
+var compressionNames = map[uint16]string{
+	cNone:       "none",
+	cCCITT:      "CCITT modified Huffman",
+	cG3:         "CCITT Group 3 fax",
+	cG4:         "CCITT Group 4 fax",
+	cLZW:        "LZW",
+	cJPEGOld:    "old-style JPEG",
+	cJPEG:       "JPEG",
+	cDeflate:    "Deflate",
+	cPackBits:   "PackBits",
+	cDeflateOld: "Deflate",
+	cLZMA:       "LZMA",
+	cJPEGXL:     "JPEG XL",
+}
+
 // Photometric interpretation values (see p. 37 of the spec).
 const (
 	pWhiteIsZero = 0
@@ -231,10 +271,64 @@ const (
 	pCIELab      = 8
 )
 
+// photometricNames names the photometric interpretations for reports.
+var photometricNames = map[uint16]string{
+	pWhiteIsZero: "WhiteIsZero",
+	pBlackIsZero: "BlackIsZero",
+	pRGB:         "RGB",
+	pPaletted:    "Palette",
+	pTransMask:   "TransparencyMask",
+	pCMYK:        "CMYK",
+	pYCbCr:       "YCbCr",
+	pCIELab:      "CIELab",
+}
+
+// Exported data types, compression and photometric interpretation values,
+// for callers interpreting the fields of an ImgDesc.
+const (
+	DataTypeByte     = dtByte
+	DataTypeASCII    = dtASCII
+	DataTypeShort    = dtShort
+	DataTypeLong     = dtLong
+	DataTypeRational = dtRational
+	DataTypeFloat32  = dtFloat32
+	DataTypeFloat64  = dtFloat64
+
+	CompressionNone     = cNone
+	CompressionLZW      = cLZW
+	CompressionJPEG     = cJPEG
+	CompressionDeflate  = cDeflate
+	CompressionPackBits = cPackBits
+
+	PhotometricWhiteIsZero = pWhiteIsZero
+	PhotometricBlackIsZero = pBlackIsZero
+	PhotometricRGB         = pRGB
+	PhotometricPaletted    = pPaletted
+	PhotometricTransMask   = pTransMask
+	PhotometricCMYK        = pCMYK
+	PhotometricYCbCr       = pYCbCr
+	PhotometricCIELab      = pCIELab
+)
+
+// Bits of the NewSubfileType tag (p. 36 of the spec).
+const (
+	sfReducedImage = 1 // Reduced resolution version of another image.
+	sfPage         = 2 // Single page of a multi-page image.
+	sfMask         = 4 // Transparency mask for another image.
+)
+
+// Values for the ExtraSamples tag (p. 31 of the spec).
+const (
+	esUnspecified  = 0
+	esAssocAlpha   = 1 // Premultiplied alpha.
+	esUnassocAlpha = 2 // Straight alpha.
+)
+
 // Values for the tPredictor tag (page 64-65 of the spec).
 const (
-	prNone       = 1
-	prHorizontal = 2
+	prNone          = 1
+	prHorizontal    = 2
+	prFloatingPoint = 3 // Adobe Photoshop TIFF Technical Note 3.
 )
 
 // Values for the tResolutionUnit tag (page 18).
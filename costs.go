@@ -0,0 +1,29 @@
+package gocog
+
+import "image"
+
+// TileCost records what a tile took to decode.
+type TileCost struct {
+	// Tile is the index of the tile in the TileOffsets of its level.
+	Tile              int
+	CompressedBytes   int64
+	DecompressedBytes int
+}
+
+// DecodeLevelSubImageCosts is DecodeLevelSubImage, also returning the cost
+// of each tile decoded, in the order they were, for callers tuning their
+// caching or prefetching. The compressed size of a tile is the number of
+// bytes read for it from the file.
+func (r *Reader) DecodeLevelSubImageCosts(level int, rect image.Rectangle) (image.Image, []TileCost, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, nil, err
+	}
+	var costs []TileCost
+	d := r.d
+	d.costs = &costs
+	img, err := decodeLevelSubImage(d, level, rect, 1, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, costs, nil
+}
@@ -2,7 +2,9 @@ package gocog
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -29,8 +31,14 @@ const (
 	LinearMeter ProjLinearUnits = "metre"
 
 	//Section 6.3.1.4 codes
-	AngularRadian GeogAngularUnits = "radian"
-	AngularDegree GeogAngularUnits = "degree"
+	AngularRadian        GeogAngularUnits = "radian"
+	AngularDegree        GeogAngularUnits = "degree"
+	AngularArcMinute     GeogAngularUnits = "arc-minute"
+	AngularArcSecond     GeogAngularUnits = "arc-second"
+	AngularGrad          GeogAngularUnits = "grad"
+	AngularGon           GeogAngularUnits = "gon"
+	AngularDMS           GeogAngularUnits = "DMS"
+	AngularDMSHemisphere GeogAngularUnits = "DMS hemisphere"
 
 	//Section 6.3.2.1 codes
 	GCS_WGS84           GeographicType = "WGS_84"
@@ -60,6 +68,24 @@ const (
 	CTSinusoidal         ProjCoordTrans = "Sinusoidal"
 )
 
+// Radians returns the number of radians in one unit, or false if the unit
+// is not known.
+func (u GeogAngularUnits) Radians() (float64, bool) {
+	switch u {
+	case AngularRadian:
+		return 1, true
+	case AngularDegree, AngularDMS, AngularDMSHemisphere:
+		return math.Pi / 180, true
+	case AngularArcMinute:
+		return math.Pi / (180 * 60), true
+	case AngularArcSecond:
+		return math.Pi / (180 * 3600), true
+	case AngularGrad, AngularGon:
+		return math.Pi / 200, true
+	}
+	return 0, false
+}
+
 type GeoData struct {
 	ModelType
 	RasterType
@@ -88,7 +114,29 @@ type KeyEntry struct {
 	KeyID, TIFFTagLocation, Count, ValueOffset uint16
 }
 
-func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
+func (g *GeoData) extract(k KeyEntry, dir []uint16, dParams []float64, aParams string) error {
+	// SHORT values may be stored in the GeoKeyDirectory itself, after the
+	// keys, instead of in ValueOffset. The keys handled here hold a single
+	// one.
+	if k.TIFFTagLocation == tGeoKeyDirectory {
+		if k.Count == 0 || int(k.ValueOffset)+int(k.Count) > len(dir) {
+			return FormatError(fmt.Sprintf("GeoKey %d: values at %d beyond the GeoKeyDirectory", k.KeyID, k.ValueOffset))
+		}
+		k.TIFFTagLocation, k.ValueOffset = 0, dir[k.ValueOffset]
+	}
+	// Files whose keys all hold SHORT values, such as those written by
+	// Encode, have no params tags.
+	switch k.TIFFTagLocation {
+	case GeoDoubleParamsTag:
+		if int(k.ValueOffset) >= len(dParams) {
+			return FormatError(fmt.Sprintf("GeoKey %d: value at %d beyond the GeoDoubleParams", k.KeyID, k.ValueOffset))
+		}
+	case GeoAsciiParamsTag:
+		if int(k.ValueOffset)+int(k.Count) > len(aParams) {
+			return FormatError(fmt.Sprintf("GeoKey %d: values at %d beyond the GeoAsciiParams", k.KeyID, k.ValueOffset))
+		}
+	}
+
 	switch k.KeyID {
 	case GTModelTypeGeoKey:
 		switch k.ValueOffset {
@@ -122,7 +170,7 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		case 32767:
 			g.GeographicType = UserDefinedGeogType
 		default:
-			return FormatError(fmt.Sprintf("GeographicType: %d not recognised", k.ValueOffset))
+			return FormatError(fmt.Sprintf("GeographicType: %d (%s) not recognised", k.ValueOffset, EPSGName(int(k.ValueOffset))))
 		}
 	case GeogCitationGeoKey:
 		if k.TIFFTagLocation != GeoAsciiParamsTag {
@@ -136,7 +184,7 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		case 32767:
 			g.GeogGeodeticDatum = UserDefinedGeodDatum
 		default:
-			return FormatError(fmt.Sprintf("GeogGeodeticDatum: %d not recognised", k.ValueOffset))
+			return FormatError(fmt.Sprintf("GeogGeodeticDatum: %d (%s) not recognised", k.ValueOffset, EPSGName(int(k.ValueOffset))))
 		}
 	case GeogAngularUnitsGeoKey:
 		switch k.ValueOffset {
@@ -144,8 +192,22 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 			g.GeogAngularUnits = AngularRadian
 		case 9102:
 			g.GeogAngularUnits = AngularDegree
+		case 9103:
+			g.GeogAngularUnits = AngularArcMinute
+		case 9104:
+			g.GeogAngularUnits = AngularArcSecond
+		case 9105:
+			g.GeogAngularUnits = AngularGrad
+		case 9106:
+			g.GeogAngularUnits = AngularGon
+		case 9107:
+			g.GeogAngularUnits = AngularDMS
+		case 9108:
+			g.GeogAngularUnits = AngularDMSHemisphere
 		default:
-			return FormatError(fmt.Sprintf("GeogAngularUnits: %d not recognised", k.ValueOffset))
+			// Rarely used units are kept by their code, they only matter
+			// to the callers asking for the CRS.
+			g.GeogAngularUnits = GeogAngularUnits(strconv.Itoa(int(k.ValueOffset)))
 		}
 	case GeogEllipsoidGeoKey:
 		switch k.ValueOffset {
@@ -156,7 +218,7 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		case 32767:
 			g.GeogEllipsoid = UserDefinedGeogEllipsoid
 		default:
-			return FormatError(fmt.Sprintf("GeogEllipsoid: %d not recognised", k.ValueOffset))
+			return FormatError(fmt.Sprintf("GeogEllipsoid: %d (%s) not recognised", k.ValueOffset, EPSGName(int(k.ValueOffset))))
 		}
 	case GeogSemiMajorAxisGeoKey:
 		if k.TIFFTagLocation != GeoDoubleParamsTag {
@@ -189,7 +251,7 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		case 32767:
 			g.ProjCSTType = UserDefinedCSTType
 		default:
-			return FormatError(fmt.Sprintf("ProjectedCSType: %d not recognised", k.ValueOffset))
+			return FormatError(fmt.Sprintf("ProjectedCSType: %d (%s) not recognised", k.ValueOffset, EPSGName(int(k.ValueOffset))))
 		}
 	case ProjectionGeoKey:
 		switch k.ValueOffset {
@@ -214,7 +276,7 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		case 9001:
 			g.ProjLinearUnits = LinearMeter
 		default:
-			return FormatError(fmt.Sprintf("ProjLinearUnits: %d not recognised", k.ValueOffset))
+			return FormatError(fmt.Sprintf("ProjLinearUnits: %d (%s) not recognised", k.ValueOffset, EPSGName(int(k.ValueOffset))))
 		}
 	case ProjFalseEastingGeoKey:
 		if k.TIFFTagLocation != GeoDoubleParamsTag {
@@ -232,16 +294,16 @@ func (g *GeoData) extract(k KeyEntry, dParams []float64, aParams string) error {
 		}
 		g.ProjCenterLong = dParams[k.ValueOffset]
 	default:
-		return FormatError(fmt.Sprintf("GeoKey: %d not implemented", k.ValueOffset))
+		return FormatError(fmt.Sprintf("GeoKey: %d (%s) not implemented", k.KeyID, GeoKeyName(k.KeyID)))
 	}
 
 	return nil
 }
 
-func parseGeoKeyDirectory(kEntries []KeyEntry, dParams []float64, aParams string) (GeoData, error) {
+func parseGeoKeyDirectory(kEntries []KeyEntry, dir []uint16, dParams []float64, aParams string) (GeoData, error) {
 	gc := GeoData{}
 	for _, kEntry := range kEntries {
-		err := gc.extract(kEntry, dParams, aParams)
+		err := gc.extract(kEntry, dir, dParams, aParams)
 		if err != nil {
 			return gc, err
 		}
@@ -319,7 +381,14 @@ func (gd GeoData) WKT() (string, error) {
 	}
 	str += fmt.Sprintf("%f],", gd.GeogPrimeMeridianLong)
 
-	str += fmt.Sprintf(`UNIT["%s",%f]],`, string(gd.GeogAngularUnits), 0.0174532925199433)
+	radians, ok := gd.GeogAngularUnits.Radians()
+	if !ok {
+		return "", fmt.Errorf("Angular units %s not implemented", gd.GeogAngularUnits)
+	}
+	// %f would round the degree factor to 0.017453, so print it with the
+	// precision used by GDAL, giving 1 for radians and 0.0174532925199433
+	// for degrees.
+	str += fmt.Sprintf(`UNIT["%s",%.16g]],`, string(gd.GeogAngularUnits), radians)
 
 	str += fmt.Sprintf(`PROJECTION["%s"],`, gd.ProjCoordTrans)
 	str += fmt.Sprintf(`PARAMETER["%s",%f],`, "longitude_of_center", gd.ProjCenterLong)
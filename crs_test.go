@@ -0,0 +1,27 @@
+package gocog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWKTAngularUnit(t *testing.T) {
+	tests := []struct {
+		units  GeogAngularUnits
+		factor string
+	}{
+		{AngularRadian, "1"},
+		{AngularDegree, "0.0174532925199433"},
+	}
+	for _, tt := range tests {
+		gd := GeoData{ModelType: Projected, GeogAngularUnits: tt.units, ProjCoordTrans: CTSinusoidal, ProjLinearUnits: LinearMeter}
+		wkt, err := gd.WKT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf(`UNIT["%s",%s]]`, tt.units, tt.factor); !strings.Contains(wkt, want) {
+			t.Fatalf("%s: WKT %s does not contain %s", tt.units, wkt, want)
+		}
+	}
+}
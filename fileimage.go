@@ -0,0 +1,190 @@
+package gocog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// A FileImage is a gray image whose samples are stored in a file rather
+// than in memory, row after row in little-endian order. It lets a whole
+// level be decoded regardless of its size. The last row read is cached, so
+// scanning the image row by row only reads each row once. A FileImage is
+// not safe for concurrent use.
+type FileImage struct {
+	f     *os.File
+	rect  image.Rectangle
+	model color.Model
+	size  int // bytes per sample
+
+	row  []byte
+	rowY int
+}
+
+// DecodeLevelToFile decodes the whole image at level one tile at a time,
+// writing the samples to f, so memory use is bounded by the tile size. The
+// returned image reads its pixels back from f, which must stay open while
+// the image is in use and is left for the caller to close and remove.
+func (r *Reader) DecodeLevelToFile(level int, f *os.File) (*FileImage, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	// The range, if requested, is gathered along the way.
+	autoRange := false
+	var progress func(done, total int)
+	if r.d.opts != nil {
+		autoRange, progress = r.d.opts.AutoRange, r.d.opts.Progress
+	}
+
+	cfg := r.d.gt.Overviews[level]
+	img := &FileImage{f: f, rect: image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)), model: r.d.colorModel(level), rowY: -1}
+	if img.size = sampleSize(img.model); img.size == 0 {
+		return nil, UnsupportedError(fmt.Sprintf("file backed decoding of %T images", img.model))
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	buf := make([]byte, int(cfg.TileWidth)*img.size)
+	err := r.d.eachTile(level, func(tile image.Image, done, total int) error {
+		if autoRange {
+			lo, hi := sampleRange(tile)
+			min, max = math.Min(min, lo), math.Max(max, hi)
+		}
+		if err := img.writeTile(tile, buf); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(done, total)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if autoRange {
+		img.model = rangeModel(img.model, min, max)
+	}
+	return img, nil
+}
+
+// writeTile stores the samples of tile, using buf as scratch space for a
+// row.
+func (p *FileImage) writeTile(tile image.Image, buf []byte) error {
+	at, err := sampleAt(tile)
+	if err != nil {
+		return err
+	}
+	b := tile.Bounds()
+	row := buf[:b.Dx()*p.size]
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			putSample(p.model, row[(x-b.Min.X)*p.size:], at(x, y))
+		}
+		if _, err := p.f.WriteAt(row, p.offset(b.Min.X, y)); err != nil {
+			return fmt.Errorf("writing decoded row %d: %w", y, err)
+		}
+	}
+	return nil
+}
+
+// offset returns the position of the sample at x, y in the file.
+func (p *FileImage) offset(x, y int) int64 {
+	return (int64(y)*int64(p.rect.Dx()) + int64(x)) * int64(p.size)
+}
+
+// sampleSize returns the number of bytes of a sample of the gray color
+// model m, or 0 if it is not one.
+func sampleSize(m color.Model) int {
+	switch m.(type) {
+	case scicolor.GrayU8Model, scicolor.GrayS8Model:
+		return 1
+	case scicolor.GrayU16Model, scicolor.GrayS16Model:
+		return 2
+	case GrayF64Model:
+		return 8
+	}
+	return 0
+}
+
+// putSample encodes v as a little-endian sample of the gray color model m
+// in the first bytes of b.
+func putSample(m color.Model, b []byte, v float64) {
+	switch m.(type) {
+	case scicolor.GrayU8Model:
+		b[0] = uint8(v)
+	case scicolor.GrayS8Model:
+		b[0] = uint8(int8(v))
+	case scicolor.GrayU16Model:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case scicolor.GrayS16Model:
+		binary.LittleEndian.PutUint16(b, uint16(int16(v)))
+	case GrayF64Model:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	}
+}
+
+func (p *FileImage) ColorModel() color.Model { return p.model }
+
+func (p *FileImage) Bounds() image.Rectangle { return p.rect }
+
+// At returns the pixel at x, y, or a zero pixel if it is outside the image
+// or cannot be read.
+func (p *FileImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.rect)) {
+		return p.pixel(nil)
+	}
+	if y != p.rowY {
+		if p.row == nil {
+			p.row = make([]byte, p.rect.Dx()*p.size)
+		}
+		if _, err := p.f.ReadAt(p.row, p.offset(0, y)); err != nil {
+			p.rowY = -1
+			return p.pixel(nil)
+		}
+		p.rowY = y
+	}
+	return p.pixel(p.row[x*p.size:])
+}
+
+// pixel decodes the sample at the start of b, or returns a zero pixel if b
+// is nil.
+func (p *FileImage) pixel(b []byte) color.Color {
+	if b == nil {
+		b = make([]byte, p.size)
+	}
+	switch m := p.model.(type) {
+	case scicolor.GrayU8Model:
+		return scicolor.GrayU8{b[0], m.Min, m.Max}
+	case scicolor.GrayS8Model:
+		return scicolor.GrayS8{int8(b[0]), m.Min, m.Max}
+	case scicolor.GrayU16Model:
+		return scicolor.GrayU16{binary.LittleEndian.Uint16(b), m.Min, m.Max}
+	case scicolor.GrayS16Model:
+		return scicolor.GrayS16{int16(binary.LittleEndian.Uint16(b)), m.Min, m.Max}
+	case GrayF64Model:
+		return GrayF64{math.Float64frombits(binary.LittleEndian.Uint64(b)), m.Min, m.Max}
+	}
+	return nil
+}
+
+// rangeModel returns model with its range set to [min, max].
+func rangeModel(model color.Model, min, max float64) color.Model {
+	switch model.(type) {
+	case scicolor.GrayU8Model:
+		return scicolor.GrayU8Model{Min: uint8(min), Max: uint8(max)}
+	case scicolor.GrayS8Model:
+		return scicolor.GrayS8Model{Min: int8(min), Max: int8(max)}
+	case scicolor.GrayU16Model:
+		return scicolor.GrayU16Model{Min: uint16(min), Max: uint16(max)}
+	case scicolor.GrayS16Model:
+		return scicolor.GrayS16Model{Min: int16(min), Max: int16(max)}
+	case GrayF64Model:
+		return GrayF64Model{Min: min, Max: max}
+	}
+	return model
+}
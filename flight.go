@@ -0,0 +1,71 @@
+package gocog
+
+import (
+	"io"
+	"sync"
+)
+
+// tileKey identifies a tile of a level of the file.
+type tileKey struct {
+	level, tile int
+}
+
+// tileCall is a decompression of a tile in progress, or just finished.
+type tileCall struct {
+	done    chan struct{}
+	buf     []byte
+	err     error
+	waiters int
+}
+
+// tileFlight coalesces concurrent decompressions of the same tile, so
+// overlapping requests sharing a Reader decompress each tile once. It is
+// shared by every copy of a decoder.
+type tileFlight struct {
+	mu    sync.Mutex
+	calls map[tileKey]*tileCall
+}
+
+func newTileFlight() *tileFlight {
+	return &tileFlight{calls: map[tileKey]*tileCall{}}
+}
+
+// loadTile is readTile, coalesced with any concurrent load of the same tile
+// of level. Tiles are undone in place once loaded, so when a decompression
+// is shared every caller gets its own copy of the bytes.
+func (d *decoder) loadTile(level int, cfg ImgDesc, src io.ReaderAt, tile int, offset, n int64) error {
+	f := d.flight
+	if f == nil {
+		return d.readTile(cfg, src, tile, offset, n)
+	}
+
+	key := tileKey{level, tile}
+	f.mu.Lock()
+	if c, ok := f.calls[key]; ok {
+		c.waiters++
+		f.mu.Unlock()
+		<-c.done
+		if c.err != nil {
+			return c.err
+		}
+		d.buf = append([]byte(nil), c.buf...)
+		return nil
+	}
+	c := &tileCall{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	c.err = d.readTile(cfg, src, tile, offset, n)
+	c.buf = d.buf
+
+	f.mu.Lock()
+	delete(f.calls, key)
+	shared := c.waiters > 0
+	f.mu.Unlock()
+	close(c.done)
+
+	if shared && c.err == nil {
+		d.buf = append([]byte(nil), c.buf...)
+	}
+	return c.err
+}
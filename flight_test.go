@@ -0,0 +1,106 @@
+package gocog
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// gatedReaderAt is an io.ReaderAt over data whose first read signals
+// started and then waits for release, failing with err if set.
+type gatedReaderAt struct {
+	data    []byte
+	err     error
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	g.once.Do(func() {
+		close(g.started)
+		<-g.release
+	})
+	if g.err != nil {
+		return 0, g.err
+	}
+	return copy(p, g.data[off:]), nil
+}
+
+func TestLoadTileShared(t *testing.T) {
+	const callers = 4
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	errRead := errors.New("read failed")
+
+	for _, fail := range []bool{false, true} {
+		src := &gatedReaderAt{data: data, started: make(chan struct{}), release: make(chan struct{})}
+		if fail {
+			src.err = errRead
+		}
+		d := decoder{flight: newTileFlight()}
+		cfg := ImgDesc{Compression: cNone}
+
+		bufs := make([][]byte, callers)
+		errs := make([]error, callers)
+		var wg sync.WaitGroup
+		load := func(i int) {
+			defer wg.Done()
+			d := d
+			errs[i] = d.loadTile(0, cfg, src, 0, 0, int64(len(data)))
+			bufs[i] = d.buf
+		}
+
+		// The first caller decompresses the tile and the others wait for
+		// it, which they are known to do once counted as waiters.
+		wg.Add(callers)
+		go load(0)
+		<-src.started
+		for i := 1; i < callers; i++ {
+			go load(i)
+		}
+		for {
+			d.flight.mu.Lock()
+			waiters := d.flight.calls[tileKey{0, 0}].waiters
+			d.flight.mu.Unlock()
+			if waiters == callers-1 {
+				break
+			}
+			runtime.Gosched()
+		}
+		close(src.release)
+		wg.Wait()
+
+		for i := 0; i < callers; i++ {
+			if fail {
+				if errs[i] != errRead {
+					t.Fatalf("caller %d: error %v, want %v", i, errs[i], errRead)
+				}
+				continue
+			}
+			if errs[i] != nil {
+				t.Fatalf("caller %d: %v", i, errs[i])
+			}
+			if !bytes.Equal(bufs[i], data) {
+				t.Fatalf("caller %d: tile %v, want %v", i, bufs[i], data)
+			}
+		}
+		if fail {
+			continue
+		}
+		// Undoing a tile in place must not alter the copies of others.
+		for i := 0; i < callers; i++ {
+			bufs[i][0] = 0xff
+			for j := i + 1; j < callers; j++ {
+				if bufs[j][0] == 0xff {
+					t.Fatalf("callers %d and %d share their tile", i, j)
+				}
+			}
+			bufs[i][0] = data[0]
+		}
+		if len(d.flight.calls) != 0 {
+			t.Fatalf("%d loads left in flight", len(d.flight.calls))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gocog
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+)
+
+// GrayF64 is a 64-bit floating point gray color. Values are displayed by
+// mapping the [Min, Max] range to black through white.
+type GrayF64 struct {
+	Y, Min, Max float64
+}
+
+func (c GrayF64) RGBA() (r, g, b, a uint32) {
+	y := uint32(0)
+	if c.Max > c.Min {
+		y = uint32(math.Round(clamp((c.Y-c.Min)/(c.Max-c.Min), 0, 1) * 0xffff))
+	}
+	return y, y, y, 0xffff
+}
+
+// GrayF64Model is the color model of GrayF64 colors with the given range.
+type GrayF64Model struct {
+	Min, Max float64
+}
+
+func (m GrayF64Model) Convert(c color.Color) color.Color {
+	if c, ok := c.(GrayF64); ok {
+		return GrayF64{c.Y, m.Min, m.Max}
+	}
+	r, g, b, _ := c.RGBA()
+	y := (19595*float64(r) + 38470*float64(g) + 7471*float64(b)) / (65536 * 0xffff)
+	return GrayF64{m.Min + y*(m.Max-m.Min), m.Min, m.Max}
+}
+
+// GrayF64Image is an in-memory image of GrayF64 colors, laid out like the
+// gray images of scimage.
+type GrayF64Image struct {
+	Pix      []float64
+	Stride   int
+	Rect     image.Rectangle
+	Min, Max float64
+}
+
+// NewGrayF64Image returns a new GrayF64Image with the given bounds and
+// range.
+func NewGrayF64Image(r image.Rectangle, min, max float64) *GrayF64Image {
+	return &GrayF64Image{Pix: make([]float64, r.Dx()*r.Dy()), Stride: r.Dx(), Rect: r, Min: min, Max: max}
+}
+
+func (p *GrayF64Image) ColorModel() color.Model { return GrayF64Model{p.Min, p.Max} }
+
+func (p *GrayF64Image) Bounds() image.Rectangle { return p.Rect }
+
+func (p *GrayF64Image) At(x, y int) color.Color { return p.GrayF64At(x, y) }
+
+func (p *GrayF64Image) GrayF64At(x, y int) GrayF64 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return GrayF64{0, p.Min, p.Max}
+	}
+	return GrayF64{p.Pix[p.PixOffset(x, y)], p.Min, p.Max}
+}
+
+// PixOffset returns the index of the element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *GrayF64Image) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x - p.Rect.Min.X)
+}
+
+func (p *GrayF64Image) SetGrayF64(x, y int, c GrayF64) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.Pix[p.PixOffset(x, y)] = c.Y
+}
+
+// undoFloatPredictor reverses the floating point predictor (Adobe
+// Photoshop TIFF Technical Note 3) on a row of samples of size bytes, 4 or
+// 8, interleaved spp at a time. The bytes of the row are stored as
+// differences and grouped by significance, most significant first. The
+// samples are left in the byte order bo.
+func undoFloatPredictor(row []byte, spp, size int, bo binary.ByteOrder) {
+	for i := spp; i < len(row); i++ {
+		row[i] += row[i-spp]
+	}
+	n := len(row) / size
+	tmp := make([]byte, len(row))
+	copy(tmp, row)
+	for i := 0; i < n; i++ {
+		var v uint64
+		for b := 0; b < size; b++ {
+			v = v<<8 | uint64(tmp[b*n+i])
+		}
+		if size == 4 {
+			bo.PutUint32(row[4*i:], uint32(v))
+		} else {
+			bo.PutUint64(row[8*i:], v)
+		}
+	}
+}
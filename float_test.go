@@ -0,0 +1,100 @@
+package gocog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// testFloat is the sample at (x, y) of the floating point test images,
+// which float32 holds exactly.
+func testFloat(x, y int) float64 {
+	return float64(x)*1.25 - float64(y)*1000.5
+}
+
+// float32Tile returns a tile of 16 by 16 little-endian float32 samples
+// holding testFloat, with the floating point predictor applied if predict
+// is set.
+func float32Tile(predict bool) []byte {
+	tile := make([]byte, 4*16*16)
+	for y := 0; y < 16; y++ {
+		row := tile[4*16*y : 4*16*(y+1)]
+		for x := 0; x < 16; x++ {
+			v := math.Float32bits(float32(testFloat(x, y)))
+			if !predict {
+				binary.LittleEndian.PutUint32(row[4*x:], v)
+				continue
+			}
+			// The bytes of the samples are grouped by significance, most
+			// significant first.
+			for b := 0; b < 4; b++ {
+				row[b*16+x] = uint8(v >> uint(24-8*b))
+			}
+		}
+		if predict {
+			for i := len(row) - 1; i > 0; i-- {
+				row[i] -= row[i-1]
+			}
+		}
+	}
+	return tile
+}
+
+func TestFloat32Model(t *testing.T) {
+	file := sampleTIFF(float32Tile(false), pBlackIsZero, 32, uint32(ieeefpSample))
+	cfg, err := DecodeConfig(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.ColorModel.(GrayF64Model); !ok {
+		t.Fatalf("color model %T, want a GrayF64Model", cfg.ColorModel)
+	}
+	img, err := DecodeLevel(bytes.NewReader(file), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := img.(*GrayF64Image)
+	if !ok {
+		t.Fatalf("decoded a %T, want a *GrayF64Image", img)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if got, want := f.GrayF64At(x, y).Y, testFloat(x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	if f.Min != testFloat(0, 15) || f.Max != testFloat(15, 0) {
+		t.Fatalf("range [%v, %v], want that of the samples", f.Min, f.Max)
+	}
+}
+
+func TestFloat32Predictor(t *testing.T) {
+	file := testTIFF([]ifdEntry{
+		{tag: cImageWidth, datatype: dtLong, data: []uint32{16}},
+		{tag: cImageLength, datatype: dtLong, data: []uint32{16}},
+		{tag: cBitsPerSample, datatype: dtShort, data: []uint32{32}},
+		{tag: cSampleFormat, datatype: dtShort, data: []uint32{uint32(ieeefpSample)}},
+		{tag: cTileWidth, datatype: dtLong, data: []uint32{16}},
+		{tag: cTileLength, datatype: dtLong, data: []uint32{16}},
+		{tag: cTileOffsets},
+		{tag: cTileByteCounts},
+		{tag: cPredictor, datatype: dtShort, data: []uint32{prFloatingPoint}},
+	}, [][]byte{float32Tile(true)})
+	img, err := DecodeLevel(bytes.NewReader(file), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := sampleAt(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if got, want := at(x, y), testFloat(x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
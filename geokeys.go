@@ -0,0 +1,126 @@
+package gocog
+
+import (
+	"fmt"
+	"sort"
+)
+
+var geoKeyNames = map[uint16]string{
+	GTModelTypeGeoKey:  "GTModelTypeGeoKey",
+	GTRasterTypeGeoKey: "GTRasterTypeGeoKey",
+	GTCitationGeoKey:   "GTCitationGeoKey",
+
+	GeographicTypeGeoKey:        "GeographicTypeGeoKey",
+	GeogCitationGeoKey:          "GeogCitationGeoKey",
+	GeogGeodeticDatumGeoKey:     "GeogGeodeticDatumGeoKey",
+	GeogPrimeMeridianGeoKey:     "GeogPrimeMeridianGeoKey",
+	GeogLinearUnitsGeoKey:       "GeogLinearUnitsGeoKey",
+	GeogLinearUnitSizeGeoKey:    "GeogLinearUnitSizeGeoKey",
+	GeogAngularUnitsGeoKey:      "GeogAngularUnitsGeoKey",
+	GeogAngularUnitSizeGeoKey:   "GeogAngularUnitSizeGeoKey",
+	GeogEllipsoidGeoKey:         "GeogEllipsoidGeoKey",
+	GeogSemiMajorAxisGeoKey:     "GeogSemiMajorAxisGeoKey",
+	GeogSemiMinorAxisGeoKey:     "GeogSemiMinorAxisGeoKey",
+	GeogInvFlatteningGeoKey:     "GeogInvFlatteningGeoKey",
+	GeogAzimuthUnitsGeoKey:      "GeogAzimuthUnitsGeoKey",
+	GeogPrimeMeridianLongGeoKey: "GeogPrimeMeridianLongGeoKey",
+
+	ProjectedCSTypeGeoKey:          "ProjectedCSTypeGeoKey",
+	PCSCitationGeoKey:              "PCSCitationGeoKey",
+	ProjectionGeoKey:               "ProjectionGeoKey",
+	ProjCoordTransGeoKey:           "ProjCoordTransGeoKey",
+	ProjLinearUnitsGeoKey:          "ProjLinearUnitsGeoKey",
+	ProjLinearUnitSizeGeoKey:       "ProjLinearUnitSizeGeoKey",
+	ProjStdParallel1GeoKey:         "ProjStdParallel1GeoKey",
+	ProjStdParallel2GeoKey:         "ProjStdParallel2GeoKey",
+	ProjNatOriginLongGeoKey:        "ProjNatOriginLongGeoKey",
+	ProjNatOriginLatGeoKey:         "ProjNatOriginLatGeoKey",
+	ProjFalseEastingGeoKey:         "ProjFalseEastingGeoKey",
+	ProjFalseNorthingGeoKey:        "ProjFalseNorthingGeoKey",
+	ProjFalseOriginLongGeoKey:      "ProjFalseOriginLongGeoKey",
+	ProjFalseOriginLatGeoKey:       "ProjFalseOriginLatGeoKey",
+	ProjFalseOriginEastingGeoKey:   "ProjFalseOriginEastingGeoKey",
+	ProjFalseOriginNorthingGeoKey:  "ProjFalseOriginNorthingGeoKey",
+	ProjCenterLongGeoKey:           "ProjCenterLongGeoKey",
+	ProjCenterLatGeoKey:            "ProjCenterLatGeoKey",
+	ProjCenterEastingGeoKey:        "ProjCenterEastingGeoKey",
+	ProjCenterNorthingGeoKey:       "ProjCenterNorthingGeoKey",
+	ProjScaleAtNatOriginGeoKey:     "ProjScaleAtNatOriginGeoKey",
+	ProjScaleAtCenterGeoKey:        "ProjScaleAtCenterGeoKey",
+	ProjAzimuthAngleGeoKey:         "ProjAzimuthAngleGeoKey",
+	ProjStraightVertPoleLongGeoKey: "ProjStraightVertPoleLongGeoKey",
+}
+
+// GeoKeyName returns the name given by the GeoTIFF spec to the GeoKey id.
+func GeoKeyName(id uint16) string {
+	if name, ok := geoKeyNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("GeoKey(%d)", id)
+}
+
+var epsgNames = map[int]string{
+	// Coordinate systems
+	3857: "WGS 84 / Pseudo-Mercator",
+	4258: "ETRS89",
+	4267: "NAD27",
+	4269: "NAD83",
+	4326: "WGS 84",
+
+	// Datums
+	6258: "European Terrestrial Reference System 1989",
+	6267: "North American Datum 1927",
+	6269: "North American Datum 1983",
+	6326: "World Geodetic System 1984",
+
+	// Ellipsoids
+	7008: "Clarke 1866",
+	7019: "GRS 1980",
+	7030: "WGS 84",
+	7035: "Sphere",
+
+	// Units
+	9001: "metre",
+	9002: "foot",
+	9101: "radian",
+	9102: "degree",
+	9103: "arc-minute",
+	9104: "arc-second",
+	9105: "grad",
+	9106: "gon",
+	9107: "degree minute second",
+	9108: "degree minute second hemisphere",
+
+	32767: "user-defined",
+}
+
+// EPSGName returns a human readable name for the EPSG code, covering the
+// codes this package understands plus the WGS 84 UTM zones.
+func EPSGName(code int) string {
+	if name, ok := epsgNames[code]; ok {
+		return name
+	}
+	switch {
+	case code >= 32601 && code <= 32660:
+		return fmt.Sprintf("WGS 84 / UTM zone %dN", code-32600)
+	case code >= 32701 && code <= 32760:
+		return fmt.Sprintf("WGS 84 / UTM zone %dS", code-32700)
+	}
+	return fmt.Sprintf("EPSG:%d", code)
+}
+
+// geoKeyDirectory returns the values of a GeoKeyDirectory tag holding
+// entries: the header, with version 1, revision 1.0 and the number of keys,
+// followed by the entries sorted by KeyID, as the GeoTIFF spec requires.
+// The entries are not modified.
+func geoKeyDirectory(entries []KeyEntry) []uint16 {
+	sorted := make([]KeyEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].KeyID < sorted[j].KeyID })
+
+	dir := []uint16{1, 1, 0, uint16(len(sorted))}
+	for _, e := range sorted {
+		dir = append(dir, e.KeyID, e.TIFFTagLocation, e.Count, e.ValueOffset)
+	}
+	return dir
+}
@@ -0,0 +1,30 @@
+package gocog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGeoKeyDirectorySorts(t *testing.T) {
+	keys := []KeyEntry{
+		{KeyID: ProjLinearUnitsGeoKey, Count: 1, ValueOffset: 9001},
+		{KeyID: GTModelTypeGeoKey, Count: 1, ValueOffset: 1},
+		{KeyID: ProjFalseEastingGeoKey, TIFFTagLocation: GeoDoubleParamsTag, Count: 1, ValueOffset: 0},
+		{KeyID: GTRasterTypeGeoKey, Count: 1, ValueOffset: 1},
+	}
+	in := append([]KeyEntry(nil), keys...)
+
+	want := []uint16{
+		1, 1, 0, 4,
+		GTModelTypeGeoKey, 0, 1, 1,
+		GTRasterTypeGeoKey, 0, 1, 1,
+		ProjLinearUnitsGeoKey, 0, 1, 9001,
+		ProjFalseEastingGeoKey, GeoDoubleParamsTag, 1, 0,
+	}
+	if got := geoKeyDirectory(keys); !reflect.DeepEqual(got, want) {
+		t.Fatalf("directory %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(keys, in) {
+		t.Fatalf("entries modified to %v", keys)
+	}
+}
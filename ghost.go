@@ -0,0 +1,58 @@
+package gocog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const ghostPrefix = "GDAL_STRUCTURAL_METADATA_SIZE="
+
+// readGhostArea parses the structural metadata block GDAL writes at the
+// start of COGs, between the header and the first IFD, which looks like:
+//
+//	GDAL_STRUCTURAL_METADATA_SIZE=000140 bytes
+//	LAYOUT=IFDS_BEFORE_DATA
+//	BLOCK_ORDER=ROW_MAJOR
+//	BLOCK_LEADER=SIZE_AS_UINT4
+//	BLOCK_TRAILER=LAST_4_BYTES_REPEATED
+//	KNOWN_INCOMPATIBLE_EDITION=NO
+//
+// It returns a nil map if the file has no such block.
+func (d *decoder) readGhostArea() (map[string]string, error) {
+	p := make([]byte, 4)
+	if _, err := d.ra.ReadAt(p, 4); err != nil {
+		return nil, fmt.Errorf("reading first IFD offset: %w", err)
+	}
+	firstIFD := int64(d.bo.Uint32(p))
+
+	// The size field is a fixed width, 6 digit number.
+	head := make([]byte, len(ghostPrefix)+len("000000 bytes\n"))
+	if firstIFD < 8+int64(len(head)) {
+		return nil, nil
+	}
+	if _, err := d.ra.ReadAt(head, 8); err != nil || !bytes.HasPrefix(head, []byte(ghostPrefix)) {
+		return nil, nil
+	}
+	size, err := strconv.Atoi(string(head[len(ghostPrefix) : len(ghostPrefix)+6]))
+	if err != nil {
+		return nil, FormatError(fmt.Sprintf("GDAL structural metadata size: %q not recognised", head))
+	}
+	if 8+int64(len(head))+int64(size) > firstIFD {
+		return nil, FormatError("GDAL structural metadata overlaps the first IFD")
+	}
+
+	body := make([]byte, size)
+	if _, err := d.ra.ReadAt(body, 8+int64(len(head))); err != nil {
+		return nil, FormatError("error reading GDAL structural metadata")
+	}
+	ghost := map[string]string{}
+	for _, line := range strings.Split(string(body), "\n") {
+		if kv := strings.SplitN(strings.TrimSpace(line), "=", 2); len(kv) == 2 {
+			ghost[kv[0]] = kv[1]
+		}
+	}
+
+	return ghost, nil
+}
@@ -0,0 +1,63 @@
+package gocog
+
+import "io"
+
+// DefaultHeaderBytes is the size of the first read of the file when a
+// Reader is created, if Options.HeaderBytes is zero. It holds the IFDs of
+// most COGs, which are all at the start of the file.
+const DefaultHeaderBytes = 16 << 10
+
+// maxHeaderBytes bounds the growth of the header read.
+const maxHeaderBytes = 4 << 20
+
+// A headerReaderAt serves the reads of the IFDs of a file from a copy of
+// its first bytes, so that parsing them takes one read of the source, or
+// a few for large headers, instead of one per IFD and tag. It is only used
+// while the IFDs are parsed and is not safe for concurrent use.
+type headerReaderAt struct {
+	ra   io.ReaderAt
+	head []byte
+	// whole is set once head holds the whole file.
+	whole bool
+}
+
+func newHeaderReaderAt(ra io.ReaderAt, n int) *headerReaderAt {
+	h := &headerReaderAt{ra: ra}
+	h.fill(n)
+	return h
+}
+
+// fill replaces the copy of the header with the first n bytes of the file.
+// Errors are left for the reads of the source to report.
+func (h *headerReaderAt) fill(n int) {
+	buf := make([]byte, n)
+	m, err := h.ra.ReadAt(buf, 0)
+	if m < len(h.head) {
+		return
+	}
+	h.head, h.whole = buf[:m], err == io.EOF
+}
+
+// ReadAt copies from the header when it holds p, growing it first when p
+// lies just past it, and reads from the source otherwise.
+func (h *headerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return h.ra.ReadAt(p, off)
+	}
+	end := off + int64(len(p))
+	if n := int64(len(h.head)); end > n && !h.whole && off < 2*n && end <= maxHeaderBytes {
+		h.fill(int(minInt64(maxInt64(2*n, end), maxHeaderBytes)))
+	}
+	if end <= int64(len(h.head)) {
+		return copy(p, h.head[off:end]), nil
+	}
+	return h.ra.ReadAt(p, off)
+}
+
+// headerBytes returns the size of the first read of the file set by opts.
+func headerBytes(opts *Options) int {
+	if opts == nil || opts.HeaderBytes == 0 {
+		return DefaultHeaderBytes
+	}
+	return opts.HeaderBytes
+}
@@ -0,0 +1,82 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// Histogram counts the sample values of the image at level in bins of equal
+// width, skipping NaN and those equal to the nodata value. It returns the
+// counts along with the lower edge of the first bin and the upper edge of
+// the last one. When integer samples span no more than bins values, a bin
+// is used per value, so fewer bins may be returned. The level is decoded
+// tile by tile, twice: once to find the range of the samples and once to
+// count them.
+func (r *Reader) Histogram(level, bins int) ([]uint64, float64, float64, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, 0, 0, err
+	}
+	if bins < 1 {
+		return nil, 0, 0, fmt.Errorf("number of bins %d must be positive", bins)
+	}
+
+	skip := func(v float64) bool { return math.IsNaN(v) || r.d.gt.hasNoData && v == r.d.gt.NoData }
+	visit := func(fn func(v float64)) error {
+		return r.d.eachTile(level, func(tile image.Image, done, total int) error {
+			at, err := sampleAt(tile)
+			if err != nil {
+				return err
+			}
+			b := tile.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if v := at(x, y); !skip(v) {
+						fn(v)
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	err := visit(func(v float64) {
+		min, max = math.Min(min, v), math.Max(max, v)
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if min > max {
+		return nil, 0, 0, fmt.Errorf("level %d has no valid samples", level)
+	}
+
+	// Bins of one integer value have their upper edge one past it.
+	switch r.d.colorModel(level).(type) {
+	case scicolor.GrayU8Model, scicolor.GrayS8Model, scicolor.GrayU16Model, scicolor.GrayS16Model:
+		if n := int(max-min) + 1; n <= bins {
+			bins = n
+			max++
+		}
+	}
+	width := (max - min) / float64(bins)
+	if width == 0 {
+		width = 1
+	}
+
+	counts := make([]uint64, bins)
+	err = visit(func(v float64) {
+		i := int((v - min) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return counts, min, max, nil
+}
@@ -0,0 +1,111 @@
+package gocog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FileInfo reports what Inspect found in a file. It is meant to be printed
+// as JSON, so fields that do not apply are omitted.
+type FileInfo struct {
+	ByteOrder string    `json:"byteOrder"`
+	Size      [2]uint32 `json:"size"`
+	// Levels describes every IFD of the file, in the order Decode
+	// methods number them.
+	Levels []LevelDetails `json:"levels"`
+	WKT    string         `json:"wkt,omitempty"`
+	Proj4  string         `json:"proj4,omitempty"`
+	// NoData is the GDAL nodata value, formatted as a string so that
+	// NaN survives being encoded as JSON.
+	NoData   string   `json:"noDataValue,omitempty"`
+	Metadata Metadata `json:"metadata"`
+	// Errors lists the parts of the report that could not be read, such
+	// as malformed GeoKeys, which do not stop the rest of it.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// LevelDetails describes a level of a file in a FileInfo.
+type LevelDetails struct {
+	Size            [2]uint32     `json:"size"`
+	TileSize        [2]uint32     `json:"tileSize"`
+	SubfileType     uint32        `json:"subfileType"`
+	Compression     string        `json:"compression"`
+	Predictor       uint16        `json:"predictor"`
+	SamplesPerPixel uint16        `json:"samplesPerPixel"`
+	BitsPerSample   []uint16      `json:"bitsPerSample"`
+	SampleFormat    []uint16      `json:"sampleFormat"`
+	Photometric     string        `json:"photometric"`
+	PlanarConfig    uint16        `json:"planarConfig"`
+	GeoTransform    *Geotransform `json:"geoTransform,omitempty"`
+}
+
+// Inspect reads the structure and georeferencing of the file in r without
+// decoding any tile. Only a file whose header or IFDs cannot be parsed
+// fails; other problems are listed in FileInfo.Errors.
+func Inspect(r io.ReaderAt) (FileInfo, error) {
+	d, err := newDecoderAt(r)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	rd, err := openReader(d, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	full := rd.d.gt.Overviews[0]
+	info := FileInfo{
+		ByteOrder: "little-endian",
+		Size:      [2]uint32{full.ImageWidth, full.ImageHeight},
+		Metadata:  rd.d.gt.Metadata,
+	}
+	if rd.d.bo == binary.BigEndian {
+		info.ByteOrder = "big-endian"
+	}
+	fail := func(what string, err error) {
+		info.Errors = append(info.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	for level, cfg := range rd.d.gt.Overviews {
+		ld := LevelDetails{
+			Size:            [2]uint32{cfg.ImageWidth, cfg.ImageHeight},
+			TileSize:        [2]uint32{cfg.TileWidth, cfg.TileHeight},
+			SubfileType:     cfg.NewSubfileType,
+			Compression:     compressionNames[cfg.Compression],
+			Predictor:       cfg.Predictor,
+			SamplesPerPixel: cfg.SamplesPerPixel,
+			BitsPerSample:   cfg.BitsPerSample,
+			SampleFormat:    cfg.SampleFormat,
+			Photometric:     photometricNames[cfg.PhotometricInterpr],
+			PlanarConfig:    cfg.PlanarConfig,
+		}
+		if ld.Compression == "" {
+			ld.Compression = strconv.Itoa(int(cfg.Compression))
+		}
+		if ld.Photometric == "" {
+			ld.Photometric = strconv.Itoa(int(cfg.PhotometricInterpr))
+		}
+		if gt, err := rd.Geotransform(level); err == nil {
+			ld.GeoTransform = &gt
+		}
+		info.Levels = append(info.Levels, ld)
+	}
+
+	if rd.d.gt.kEntries != nil {
+		if info.WKT, err = rd.WKT(0); err != nil {
+			fail("WKT", err)
+		}
+		if info.Proj4, err = rd.Proj4(0); err != nil {
+			fail("Proj4", err)
+		}
+	}
+	if rd.d.gt.hasNoData {
+		info.NoData = strconv.FormatFloat(rd.d.gt.NoData, 'g', -1, 64)
+	}
+	if _, err := rd.Metadata(); err != nil {
+		fail("metadata", err)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,103 @@
+package gocog
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets holds the upper bounds of the buckets of the read latency
+// histogram of ReadStats. Reads slower than the last bound are counted in
+// an extra, final bucket.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// ReadStats summarizes the reads made through an InstrumentedReaderAt.
+type ReadStats struct {
+	Reads  int
+	Errors int
+	Bytes  int64
+	// Total is the time spent in all reads, which overlap when they are
+	// made concurrently, and Max that of the slowest one.
+	Total time.Duration
+	Max   time.Duration
+	// Latency counts the reads by duration, the i-th bucket holding
+	// those no slower than LatencyBuckets[i] and not counted before.
+	Latency []int
+}
+
+// InstrumentedReaderAt wraps an io.ReaderAt, recording the number, size
+// and latency of the reads made through it. It is safe for concurrent use.
+// As NewReader takes an io.Reader, the wrapper is passed to it as
+// io.NewSectionReader(ir, 0, size).
+type InstrumentedReaderAt struct {
+	ra io.ReaderAt
+
+	mu    sync.Mutex
+	stats ReadStats
+}
+
+// NewInstrumentedReaderAt returns an InstrumentedReaderAt reading from ra.
+func NewInstrumentedReaderAt(ra io.ReaderAt) *InstrumentedReaderAt {
+	return &InstrumentedReaderAt{
+		ra:    ra,
+		stats: ReadStats{Latency: make([]int, len(LatencyBuckets)+1)},
+	}
+}
+
+// ReadAt reads from the wrapped io.ReaderAt, timing the read.
+func (r *InstrumentedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := r.ra.ReadAt(p, off)
+	elapsed := time.Since(start)
+
+	b := 0
+	for b < len(LatencyBuckets) && elapsed > LatencyBuckets[b] {
+		b++
+	}
+
+	r.mu.Lock()
+	s := &r.stats
+	s.Reads++
+	if err != nil && err != io.EOF {
+		s.Errors++
+	}
+	s.Bytes += int64(n)
+	s.Total += elapsed
+	if elapsed > s.Max {
+		s.Max = elapsed
+	}
+	s.Latency[b]++
+	r.mu.Unlock()
+
+	return n, err
+}
+
+// Stats returns the statistics of the reads made so far.
+func (r *InstrumentedReaderAt) Stats() ReadStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	s.Latency = append([]int(nil), r.stats.Latency...)
+	return s
+}
+
+// Reset clears the statistics, for instance between the runs of a
+// benchmark.
+func (r *InstrumentedReaderAt) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = ReadStats{Latency: make([]int, len(LatencyBuckets)+1)}
+}
@@ -0,0 +1,110 @@
+package gocog
+
+import "image"
+
+// TilesIntersecting returns the rectangles, in pixel coordinates of level,
+// of the tiles that overlap the polygon with the given vertices, so they
+// can be decoded one by one. Tiles of the right and bottom edges are
+// clipped to the image. It returns nil if level does not exist or the
+// polygon has fewer than three vertices.
+func (r *Reader) TilesIntersecting(level int, poly []image.Point) []image.Rectangle {
+	if r.d.checkLevel(level) != nil || len(poly) < 3 {
+		return nil
+	}
+	cfg := r.d.gt.Overviews[level]
+	if cfg.TileWidth == 0 || cfg.TileHeight == 0 {
+		return nil
+	}
+	tw, th := int(cfg.TileWidth), int(cfg.TileHeight)
+	bounds := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
+
+	// Only the tiles within the bounding box of the polygon can overlap it.
+	bbox := image.Rectangle{poly[0], poly[0].Add(image.Pt(1, 1))}
+	for _, p := range poly[1:] {
+		bbox = bbox.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+	}
+	bbox = bbox.Intersect(bounds)
+	if bbox.Empty() {
+		return nil
+	}
+
+	var tiles []image.Rectangle
+	for y := bbox.Min.Y / th * th; y < bbox.Max.Y; y += th {
+		for x := bbox.Min.X / tw * tw; x < bbox.Max.X; x += tw {
+			tile := image.Rect(x, y, x+tw, y+th).Intersect(bounds)
+			if polygonOverlaps(poly, tile) {
+				tiles = append(tiles, tile)
+			}
+		}
+	}
+	return tiles
+}
+
+// polygonOverlaps reports whether the polygon and the rectangle r share
+// any area or boundary. Either one has a vertex inside the other or an edge
+// of the polygon crosses an edge of r.
+func polygonOverlaps(poly []image.Point, r image.Rectangle) bool {
+	for _, p := range poly {
+		if p.In(r) {
+			return true
+		}
+	}
+	corners := []image.Point{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}}
+	if insidePolygon(poly, corners[0]) {
+		return true
+	}
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		for j := range corners {
+			if segmentsCross(a, b, corners[j], corners[(j+1)%len(corners)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insidePolygon reports whether p is inside the polygon, using the even-odd
+// rule.
+func insidePolygon(poly []image.Point, p image.Point) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			float64(p.X) < float64(b.X-a.X)*float64(p.Y-a.Y)/float64(b.Y-a.Y)+float64(a.X) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// segmentsCross reports whether the segments ab and cd intersect.
+func segmentsCross(a, b, c, d image.Point) bool {
+	d1, d2 := orientation(c, d, a), orientation(c, d, b)
+	d3, d4 := orientation(a, b, c), orientation(a, b, d)
+	if d1*d2 < 0 && d3*d4 < 0 {
+		return true
+	}
+	return d1 == 0 && onSegment(c, d, a) || d2 == 0 && onSegment(c, d, b) ||
+		d3 == 0 && onSegment(a, b, c) || d4 == 0 && onSegment(a, b, d)
+}
+
+// orientation returns the sign of the cross product of ab and ac: positive
+// if c is to the left of ab, negative if to the right and zero if the three
+// points are collinear.
+func orientation(a, b, c image.Point) int {
+	v := int64(b.X-a.X)*int64(c.Y-a.Y) - int64(b.Y-a.Y)*int64(c.X-a.X)
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// onSegment reports whether c, collinear with a and b, lies between them.
+func onSegment(a, b, c image.Point) bool {
+	return minInt(a.X, b.X) <= c.X && c.X <= maxInt(a.X, b.X) &&
+		minInt(a.Y, b.Y) <= c.Y && c.Y <= maxInt(a.Y, b.Y)
+}
@@ -0,0 +1,81 @@
+package gocog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxLayoutIssues bounds the number of problems CheckTileLayout lists.
+const maxLayoutIssues = 10
+
+// CheckTileLayout checks that the data of the tiles of level, as given by
+// their TileOffsets and TileByteCounts, do not overlap and, when the size
+// of the source is known, lie within the file. It returns a FormatError
+// naming the offending tiles, if any. Tiles sharing the very same data, as
+// written by encoders deduplicating empty tiles, and tiles without data are
+// allowed. ordered reports whether the offsets of the tiles with data
+// increase with their index, which read coalescing relies on to merge
+// neighbouring tiles.
+func (r *Reader) CheckTileLayout(level int) (ordered bool, err error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return false, err
+	}
+	cfg := r.d.gt.Overviews[level]
+	if len(cfg.TileByteCounts) < len(cfg.TileOffsets) {
+		return false, FormatError(fmt.Sprintf("TileByteCounts has %d entries, TileOffsets %d", len(cfg.TileByteCounts), len(cfg.TileOffsets)))
+	}
+
+	type span struct {
+		tile      int
+		off, size int64
+	}
+	var spans []span
+	for tile := range cfg.TileOffsets {
+		off, n, _ := cfg.tileLocation(tile)
+		if n > 0 {
+			spans = append(spans, span{tile, off, n})
+		}
+	}
+
+	ordered = true
+	for k := 1; k < len(spans); k++ {
+		if spans[k].off < spans[k-1].off {
+			ordered = false
+			break
+		}
+	}
+
+	var issues []string
+	report := func(format string, args ...interface{}) {
+		if len(issues) < maxLayoutIssues {
+			issues = append(issues, fmt.Sprintf(format, args...))
+		}
+	}
+	if size, ok := readerSize(r.d.ra); ok {
+		for _, s := range spans {
+			if s.off+s.size > size {
+				report("tile %d ends at %d, past the end of the file (%d bytes)", s.tile, s.off+s.size, size)
+			}
+		}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].off < spans[j].off })
+	// end is the span reaching the furthest among those seen so far.
+	for k, end := 1, 0; k < len(spans); k++ {
+		cur, prev := spans[k], spans[end]
+		switch {
+		case cur.off == prev.off && cur.size == prev.size:
+		case cur.off < prev.off+prev.size:
+			report("tiles %d and %d overlap", prev.tile, cur.tile)
+		}
+		if cur.off+cur.size > prev.off+prev.size {
+			end = k
+		}
+	}
+
+	if len(issues) > 0 {
+		return ordered, FormatError(fmt.Sprintf("level %d: %s", level, strings.Join(issues, "; ")))
+	}
+	return ordered, nil
+}
@@ -0,0 +1,70 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// maskLevel returns the level holding the transparency mask of level: the
+// IFD marked as a mask with the same size.
+func (d *decoder) maskLevel(level int) (int, bool) {
+	cfg := d.gt.Overviews[level]
+	if cfg.NewSubfileType&sfMask != 0 {
+		return 0, false
+	}
+	for k, m := range d.gt.Overviews {
+		if m.NewSubfileType&sfMask != 0 && m.ImageWidth == cfg.ImageWidth && m.ImageHeight == cfg.ImageHeight {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// DecodeWithMask decodes the part of the image at level that intersects
+// rect along with the same part of its transparency mask, as written by
+// GDAL for the COGs whose compression cannot represent nodata. Masked out
+// pixels have an alpha of 0, the others of 0xff. It fails if level has no
+// mask.
+func (r *Reader) DecodeWithMask(level int, rect image.Rectangle) (image.Image, *image.Alpha, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, nil, err
+	}
+	mlevel, ok := r.d.maskLevel(level)
+	if !ok {
+		return nil, nil, fmt.Errorf("level %d has no mask", level)
+	}
+
+	img, err := decodeLevelSubImage(r.d, level, rect, 1, -1)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Masks are decoded as plain samples, with 1-bit ones holding 0 or 1
+	// and 8-bit ones 0 or 255.
+	d := r.d
+	if d.opts != nil {
+		opts := *d.opts
+		opts.AutoRange, opts.NoDataToNaN, opts.ForceColorModel = false, false, nil
+		opts.DisplayMin, opts.DisplayMax, opts.SampleTransform = 0, 0, nil
+		d.opts = &opts
+	}
+	m, err := decodeLevelSubImage(d, mlevel, rect, 1, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding the mask: %w", err)
+	}
+	at, err := sampleAt(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := m.Bounds()
+	alpha := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if v := at(x, y); v != 0 && !math.IsNaN(v) {
+				alpha.Pix[alpha.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	return img, alpha, nil
+}
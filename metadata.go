@@ -0,0 +1,35 @@
+package gocog
+
+import (
+	"fmt"
+	"time"
+)
+
+// dateTimeLayout is the format of the DateTime tag, "YYYY:MM:DD HH:MM:SS".
+const dateTimeLayout = "2006:01:02 15:04:05"
+
+// Metadata holds the descriptive ASCII tags of an image.
+type Metadata struct {
+	ImageDescription string
+	Software         string
+	// DateTime is the creation time of the image. TIFF does not record a
+	// time zone, so it is returned as UTC.
+	DateTime time.Time
+}
+
+// setMetadata stores the value of the ASCII tag in g.Metadata.
+func (g *GeoTIFF) setMetadata(tag uint16, value string) {
+	switch tag {
+	case cImageDescription:
+		g.Metadata.ImageDescription = value
+	case cSoftware:
+		g.Metadata.Software = value
+	case cDateTime:
+		t, err := time.Parse(dateTimeLayout, value)
+		if err != nil {
+			g.metadataErr = FormatError(fmt.Sprintf("DateTime %q not in the YYYY:MM:DD HH:MM:SS format", value))
+			return
+		}
+		g.Metadata.DateTime = t
+	}
+}
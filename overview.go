@@ -0,0 +1,98 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// BuildOverviews returns levels overviews of the gray image img, each half
+// the size of the previous one, rounding up. Their pixels are the mean of
+// the 2x2 block they cover in the previous level, ignoring NaN. With
+// Options.OverviewWorkers set above one, the rows of each level are
+// computed by that many goroutines.
+func BuildOverviews(img image.Image, levels int, opts *Options) ([]image.Image, error) {
+	if levels < 0 {
+		return nil, fmt.Errorf("number of overviews %d must not be negative", levels)
+	}
+	workers := 1
+	if opts != nil && opts.OverviewWorkers > 1 {
+		workers = opts.OverviewWorkers
+	}
+
+	ovrs := make([]image.Image, 0, levels)
+	src := img
+	for k := 0; k < levels; k++ {
+		b := src.Bounds()
+		if b.Dx() <= 1 && b.Dy() <= 1 {
+			return nil, fmt.Errorf("image too small for %d overviews", levels)
+		}
+		dst, err := halve(src, workers)
+		if err != nil {
+			return nil, err
+		}
+		ovrs = append(ovrs, dst)
+		src = dst
+	}
+	return ovrs, nil
+}
+
+// halve returns src downsampled by two, averaging blocks of 2x2 pixels.
+// Rows are spread over workers goroutines.
+func halve(src image.Image, workers int) (image.Image, error) {
+	b := src.Bounds()
+	dst, err := newImage(src.ColorModel(), image.Rect(0, 0, ceilDiv(b.Dx(), 2), ceilDiv(b.Dy(), 2)))
+	if err != nil {
+		return nil, err
+	}
+	at, err := sampleAt(src)
+	if err != nil {
+		return nil, err
+	}
+	set, err := sampleSetter(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	db := dst.Bounds()
+	err = parallel(db.Dy(), workers, func(y int) error {
+		for x := 0; x < db.Dx(); x++ {
+			blk := image.Rect(2*x, 2*y, 2*x+2, 2*y+2).Add(b.Min).Intersect(b)
+			sum, n := 0.0, 0
+			for v := blk.Min.Y; v < blk.Max.Y; v++ {
+				for u := blk.Min.X; u < blk.Max.X; u++ {
+					if s := at(u, v); !math.IsNaN(s) {
+						sum += s
+						n++
+					}
+				}
+			}
+			mean := math.NaN()
+			if n > 0 {
+				mean = sum / float64(n)
+			}
+			set(x, y, mean)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// RecommendedOverviewCount returns the number of overviews GDAL builds by
+// default for an image of width by height pixels with square tiles of
+// tileSize pixels: the image is halved, rounding up, until its larger
+// dimension fits in a single tile. Images already fitting in a tile need
+// none.
+func RecommendedOverviewCount(width, height, tileSize int) int {
+	if tileSize < 1 {
+		return 0
+	}
+	n := 0
+	for size := maxInt(width, height); size > tileSize; size = ceilDiv(size, 2) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,110 @@
+package gocog
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"github.com/terrascope/scimage"
+)
+
+// DecodePNG decodes the part of the image at level that intersects rect and
+// returns it encoded as a PNG. Sample values are linearly mapped from
+// [min, max] to the full range of the PNG, clamping values outside it. The
+// PNG is 16-bit for 16 and 64-bit data and 8-bit otherwise.
+func (r *Reader) DecodePNG(level int, rect image.Rectangle, min, max float64) ([]byte, error) {
+	img, err := r.DecodeLevelSubImage(level, rect)
+	if err != nil {
+		return nil, err
+	}
+	disp, err := stretch(img, min, max)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, disp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stretch maps the samples of img from [min, max] to an image.Gray, or to
+// an image.Gray16 for 16 and 64-bit images.
+func stretch(img image.Image, min, max float64) (image.Image, error) {
+	if max <= min {
+		return nil, fmt.Errorf("invalid display range [%v, %v]", min, max)
+	}
+
+	at, err := sampleAt(img)
+	if err != nil {
+		return nil, err
+	}
+	wide := false
+	switch img.(type) {
+	case *scimage.GrayU16, *scimage.GrayS16, *GrayF64Image:
+		wide = true
+	}
+
+	b := img.Bounds()
+	scale := func(v, top float64) float64 {
+		return math.Round(clamp((v-min)/(max-min), 0, 1) * top)
+	}
+	if wide {
+		out := image.NewGray16(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := uint16(scale(at(x, y), 65535))
+				i := out.PixOffset(x, y)
+				out.Pix[i], out.Pix[i+1] = uint8(v>>8), uint8(v)
+			}
+		}
+		return out, nil
+	}
+	out := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Pix[out.PixOffset(x, y)] = uint8(scale(at(x, y), 255))
+		}
+	}
+	return out, nil
+}
+
+// ToStdImage converts the images returned by the decoder to standard library
+// types, so they can be used with packages such as image/draw or image/png.
+// Gray images are mapped from their Min and Max range to an image.Gray, or
+// an image.Gray16 for 16 and 64-bit data, and paletted images to an image.RGBA.
+// Other images are returned unchanged.
+func ToStdImage(img image.Image) image.Image {
+	var min, max float64
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		min, max = float64(img.Min), float64(img.Max)
+	case *scimage.GrayS8:
+		min, max = float64(img.Min), float64(img.Max)
+	case *scimage.GrayU16:
+		min, max = float64(img.Min), float64(img.Max)
+	case *scimage.GrayS16:
+		min, max = float64(img.Min), float64(img.Max)
+	case *GrayF64Image:
+		min, max = img.Min, img.Max
+	case *image.Paletted:
+		out := image.NewRGBA(img.Bounds())
+		draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+		return out
+	default:
+		return img
+	}
+
+	if max <= min {
+		max = min + 1
+	}
+	out, err := stretch(img, min, max)
+	if err != nil {
+		return img
+	}
+	return out
+}
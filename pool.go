@@ -0,0 +1,50 @@
+package gocog
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallel calls fn for each i in [0, n) from up to workers goroutines,
+// returning the first error. Once an error occurs the remaining calls are
+// skipped. A workers value below one uses one worker per CPU.
+func parallel(n, workers int, fn func(i int) error) error {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		mu   sync.Mutex
+		next int
+		err  error
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				i := next
+				next++
+				stop := i >= n || err != nil
+				mu.Unlock()
+				if stop {
+					return
+				}
+				if e := fn(i); e != nil {
+					mu.Lock()
+					if err == nil {
+						err = e
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
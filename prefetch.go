@@ -0,0 +1,63 @@
+package gocog
+
+import "io"
+
+type prefetchResult struct {
+	data []byte
+	err  error
+}
+
+// A prefetcher reads a sequence of byte ranges in the background, keeping
+// at most depth of them in flight or waiting to be consumed.
+type prefetcher struct {
+	results []chan prefetchResult
+	sem     chan struct{}
+	done    chan struct{}
+}
+
+// newPrefetcher starts reading ranges, given as offset and length pairs,
+// from ra.
+func newPrefetcher(ra io.ReaderAt, ranges [][2]int64, depth int) *prefetcher {
+	p := &prefetcher{
+		results: make([]chan prefetchResult, len(ranges)),
+		sem:     make(chan struct{}, depth),
+		done:    make(chan struct{}),
+	}
+	for k := range p.results {
+		p.results[k] = make(chan prefetchResult, 1)
+	}
+
+	go func() {
+		for k, rg := range ranges {
+			select {
+			case p.sem <- struct{}{}:
+			case <-p.done:
+				return
+			}
+			go func(res chan<- prefetchResult, off, n int64) {
+				data := make([]byte, n)
+				m, err := ra.ReadAt(data, off)
+				if err == io.EOF && int64(m) == n {
+					err = nil
+				}
+				res <- prefetchResult{data, err}
+			}(p.results[k], rg[0], rg[1])
+		}
+	}()
+
+	return p
+}
+
+// get waits for the k-th range to be read and returns its bytes. Ranges
+// must be consumed in order.
+func (p *prefetcher) get(k int) ([]byte, error) {
+	res := <-p.results[k]
+	<-p.sem
+	return res.data, res.err
+}
+
+// close stops issuing new reads. Reads already in flight complete in the
+// background.
+func (p *prefetcher) close() {
+	close(p.done)
+}
@@ -0,0 +1,41 @@
+package gocog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingReader is a bytes.Reader whose reads at offset failAt fail.
+type failingReader struct {
+	*bytes.Reader
+	failAt int64
+	err    error
+}
+
+func (f *failingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off == f.failAt {
+		return 0, f.err
+	}
+	return f.Reader.ReadAt(p, off)
+}
+
+func TestPrefetchError(t *testing.T) {
+	errRead := errors.New("read failed")
+	src := &failingReader{Reader: bytes.NewReader(tiledTIFF(64, 64, 16, 16)), failAt: -1, err: errRead}
+	r, err := NewReader(src, &Options{Prefetch: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second of the 16 tiles fails while the prefetcher reads ahead.
+	src.failAt = int64(r.d.gt.Overviews[0].TileOffsets[1])
+	_, err = r.DecodeLevel(0)
+	if !errors.Is(err, errRead) {
+		t.Fatalf("error %v, want %v", err, errRead)
+	}
+	if !strings.Contains(err.Error(), "tile 1") {
+		t.Fatalf("error %q does not name tile 1", err)
+	}
+}
@@ -0,0 +1,95 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// A Pyramid holds the decoded full resolution image of a file and its
+// overviews, for clients rendering it at several zoom levels from memory.
+type Pyramid struct {
+	// Levels is sorted from the finest resolution to the coarsest.
+	Levels []PyramidLevel
+}
+
+// A PyramidLevel is a decoded level of a Pyramid.
+type PyramidLevel struct {
+	// Level is the index of the level in the file, as taken by the
+	// Decode methods.
+	Level int
+	Image image.Image
+	// Factor is the decimation factor of the level, the width of the
+	// full resolution image divided by its own: 1 for the full resolution
+	// image, 2 for an overview of half its size and so on.
+	Factor float64
+	// Geotransform is that of the level, and Resolution the size of its
+	// pixels in the units of the geotransform. Files without
+	// georeferencing have a zero Geotransform, and the Resolution of their
+	// levels is their Factor, in full resolution pixels.
+	Geotransform Geotransform
+	Resolution   float64
+}
+
+// DecodePyramid decodes the full resolution image of the first page of the
+// file and all its overviews, leaving out masks. The whole pyramid is held
+// in memory: about a third more than the full resolution image alone for
+// overviews halving each time, as LevelUncompressedBytes tells for each
+// level. Each level is also bound by Options.MaxPixels.
+func (r *Reader) DecodePyramid() (*Pyramid, error) {
+	if len(r.pages) == 0 {
+		return nil, fmt.Errorf("no image level")
+	}
+	first, end := r.pages[0], len(r.d.gt.Overviews)
+	if len(r.pages) > 1 {
+		end = r.pages[1]
+	}
+
+	full := r.d.gt.Overviews[first]
+	p := &Pyramid{}
+	for level := first; level < end; level++ {
+		cfg := r.d.gt.Overviews[level]
+		if cfg.NewSubfileType&sfMask != 0 || cfg.ImageWidth == 0 {
+			continue
+		}
+		img, err := r.DecodeLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("level %d: %w", level, err)
+		}
+		pl := PyramidLevel{
+			Level:  level,
+			Image:  img,
+			Factor: float64(full.ImageWidth) / float64(cfg.ImageWidth),
+		}
+		pl.Resolution = pl.Factor
+		if gt, err := r.Geotransform(level); err == nil {
+			pl.Geotransform, pl.Resolution = gt, math.Hypot(gt[1], gt[4])
+		}
+		p.Levels = append(p.Levels, pl)
+	}
+	sort.SliceStable(p.Levels, func(i, j int) bool {
+		return p.Levels[i].Factor < p.Levels[j].Factor
+	})
+
+	return p, nil
+}
+
+// LevelForScale returns the coarsest level of p whose pixels are no larger
+// than res, in the units of PyramidLevel.Resolution, so that rendering at
+// res never upsamples. If all levels are coarser, the finest one is
+// returned. It returns nil if p holds no level.
+func (p *Pyramid) LevelForScale(res float64) *PyramidLevel {
+	if len(p.Levels) == 0 {
+		return nil
+	}
+	// Allow for rounding in the pixel sizes of the levels.
+	limit := res * (1 + 1e-9)
+	best := &p.Levels[0]
+	for k := range p.Levels {
+		if p.Levels[k].Resolution <= limit {
+			best = &p.Levels[k]
+		}
+	}
+	return best
+}
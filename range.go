@@ -0,0 +1,240 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/terrascope/scimage"
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// rangeKey identifies a band of a level, -1 standing for the samples the
+// level decodes to.
+type rangeKey struct {
+	level, band int
+}
+
+// levelRanges caches the ranges levelRange finds, which only depend on the
+// options of the Reader, so that AutoRange scans each level once. It is
+// shared by every copy of a decoder.
+type levelRanges struct {
+	mu     sync.Mutex
+	ranges map[rangeKey][2]float64
+}
+
+func newLevelRanges() *levelRanges {
+	return &levelRanges{ranges: map[rangeKey][2]float64{}}
+}
+
+// levelRange returns the smallest and largest sample values of the image at
+// level, or only of band if not negative. The level is decoded tile by
+// tile, so its size is not bound by Options.MaxPixels, and only the first
+// call for each level and band does so.
+func (d decoder) levelRange(level, band int) (float64, float64, error) {
+	key := rangeKey{level, band}
+	if d.ranges != nil {
+		d.ranges.mu.Lock()
+		r, ok := d.ranges.ranges[key]
+		d.ranges.mu.Unlock()
+		if ok {
+			return r[0], r[1], nil
+		}
+	}
+
+	rects, err := d.tileRects(level)
+	if err != nil {
+		return 0, 0, err
+	}
+	d = d.perTile()
+	d.costs = nil
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, rect := range rects {
+		tile, err := decodeLevelSubImage(d, level, rect, 1, band)
+		if err != nil {
+			return 0, 0, err
+		}
+		min, max = extendRange(tile, min, max)
+	}
+	if min > max {
+		min, max = 0, 0
+	}
+
+	if d.ranges != nil {
+		d.ranges.mu.Lock()
+		d.ranges.ranges[key] = [2]float64{min, max}
+		d.ranges.mu.Unlock()
+	}
+	return min, max, nil
+}
+
+// sampleRange returns the smallest and largest sample values of img, or
+// zeros if it has none.
+func sampleRange(img image.Image) (min, max float64) {
+	min, max = extendRange(img, math.Inf(1), math.Inf(-1))
+	if min > max {
+		return 0, 0
+	}
+	return min, max
+}
+
+// extendRange returns the smallest and largest of min, max and the sample
+// values of img, leaving out NaN.
+func extendRange(img image.Image, min, max float64) (float64, float64) {
+	update := func(v float64) {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		for _, v := range img.Pix {
+			update(float64(v))
+		}
+	case *scimage.GrayU16:
+		for _, v := range img.Pix {
+			update(float64(v))
+		}
+	case *scimage.GrayS8:
+		for _, v := range img.Pix {
+			update(float64(v))
+		}
+	case *scimage.GrayS16:
+		for _, v := range img.Pix {
+			update(float64(v))
+		}
+	case *GrayF64Image:
+		for _, v := range img.Pix {
+			if !math.IsNaN(v) {
+				update(v)
+			}
+		}
+	}
+
+	return min, max
+}
+
+// fillImage sets all the samples of img to v.
+func fillImage(img image.Image, v float64) {
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		for i := range img.Pix {
+			img.Pix[i] = uint8(v)
+		}
+	case *scimage.GrayU16:
+		for i := range img.Pix {
+			img.Pix[i] = uint16(v)
+		}
+	case *scimage.GrayS8:
+		for i := range img.Pix {
+			img.Pix[i] = int8(v)
+		}
+	case *scimage.GrayS16:
+		for i := range img.Pix {
+			img.Pix[i] = int16(v)
+		}
+	case *GrayF64Image:
+		for i := range img.Pix {
+			img.Pix[i] = v
+		}
+	case *image.Paletted:
+		for i := range img.Pix {
+			img.Pix[i] = uint8(v)
+		}
+	}
+}
+
+// imageRange returns the Min and Max range of the gray image img.
+func imageRange(img image.Image) (min, max float64) {
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		return float64(img.Min), float64(img.Max)
+	case *scimage.GrayU16:
+		return float64(img.Min), float64(img.Max)
+	case *scimage.GrayS8:
+		return float64(img.Min), float64(img.Max)
+	case *scimage.GrayS16:
+		return float64(img.Min), float64(img.Max)
+	case *GrayF64Image:
+		return img.Min, img.Max
+	}
+	return 0, 0
+}
+
+// modelRange returns the Min and Max range of the gray color model m, and
+// whether m is one.
+func modelRange(m color.Model) (min, max float64, ok bool) {
+	switch m := m.(type) {
+	case scicolor.GrayU8Model:
+		return float64(m.Min), float64(m.Max), true
+	case scicolor.GrayU16Model:
+		return float64(m.Min), float64(m.Max), true
+	case scicolor.GrayS8Model:
+		return float64(m.Min), float64(m.Max), true
+	case scicolor.GrayS16Model:
+		return float64(m.Min), float64(m.Max), true
+	case GrayF64Model:
+		return m.Min, m.Max, true
+	}
+	return 0, 0, false
+}
+
+// sampleSetter returns a function setting the sample of the gray image img
+// at x, y to v, rounded for integer images. Points outside img are ignored.
+func sampleSetter(img image.Image) (func(x, y int, v float64), error) {
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		return func(x, y int, v float64) {
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Pix[img.PixOffset(x, y)] = uint8(math.Round(v))
+			}
+		}, nil
+	case *scimage.GrayU16:
+		return func(x, y int, v float64) {
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Pix[img.PixOffset(x, y)] = uint16(math.Round(v))
+			}
+		}, nil
+	case *scimage.GrayS8:
+		return func(x, y int, v float64) {
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Pix[img.PixOffset(x, y)] = int8(math.Round(v))
+			}
+		}, nil
+	case *scimage.GrayS16:
+		return func(x, y int, v float64) {
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Pix[img.PixOffset(x, y)] = int16(math.Round(v))
+			}
+		}, nil
+	case *GrayF64Image:
+		return func(x, y int, v float64) {
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Pix[img.PixOffset(x, y)] = v
+			}
+		}, nil
+	}
+	return nil, UnsupportedError(fmt.Sprintf("sample access of %T", img))
+}
+
+// setRange sets the display range of img to [min, max].
+func setRange(img image.Image, min, max float64) {
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		img.Min, img.Max = uint8(min), uint8(max)
+	case *scimage.GrayU16:
+		img.Min, img.Max = uint16(min), uint16(max)
+	case *scimage.GrayS8:
+		img.Min, img.Max = int8(min), int8(max)
+	case *scimage.GrayS16:
+		img.Min, img.Max = int16(min), int16(max)
+	case *GrayF64Image:
+		img.Min, img.Max = min, max
+	}
+}
@@ -0,0 +1,31 @@
+package gocog
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+func TestAutoRangeTileByTile(t *testing.T) {
+	// The level holds more pixels than MaxPixels allows, but the windows
+	// decoded do not.
+	r, err := NewReader(bytes.NewReader(tiledTIFF(40, 30, 16, 16)), &Options{AutoRange: true, MaxPixels: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rect := range []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(25, 15, 40, 30)} {
+		img, err := r.DecodeLevelSubImage(0, rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := img.ColorModel(); m != (scicolor.GrayU8Model{Min: 0, Max: 126}) {
+			t.Fatalf("window %v: model %v, want the range of the level", rect, m)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+	if n := len(r.d.ranges.ranges); n != 1 {
+		t.Fatalf("%d ranges cached, want 1", n)
+	}
+}
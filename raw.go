@@ -0,0 +1,82 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// A RawHeader describes the samples written by ExportRaw.
+type RawHeader struct {
+	// DType is the NumPy type string of the samples, such as "<u2" for
+	// little-endian unsigned 16-bit integers.
+	DType string
+	// Shape holds the number of rows and columns.
+	Shape [2]int
+	// Bounds are the bounds of the samples in the pixel coordinates of
+	// the level.
+	Bounds image.Rectangle
+	// NoData is the nodata value of the file, if HasNoData is set.
+	NoData    float64
+	HasNoData bool
+}
+
+// ExportRaw decodes the part of the image at level that intersects rect and
+// writes its samples to w, row after row in little-endian order, with no
+// header. The returned RawHeader describes the layout, so the data can be
+// loaded by other programs, for instance with numpy.frombuffer.
+func (r *Reader) ExportRaw(level int, rect image.Rectangle, w io.Writer) (RawHeader, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return RawHeader{}, err
+	}
+	img, err := decodeLevelSubImage(r.d, level, rect, 1, -1)
+	if err != nil {
+		return RawHeader{}, err
+	}
+	model := img.ColorModel()
+	size := sampleSize(model)
+	at, err := sampleAt(img)
+	if size == 0 || err != nil {
+		return RawHeader{}, UnsupportedError(fmt.Sprintf("raw export of %T images", img))
+	}
+
+	b := img.Bounds()
+	hdr := RawHeader{
+		DType:     rawDType(model),
+		Shape:     [2]int{b.Dy(), b.Dx()},
+		Bounds:    b,
+		NoData:    r.d.gt.NoData,
+		HasNoData: r.d.gt.hasNoData,
+	}
+	row := make([]byte, b.Dx()*size)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			putSample(model, row[(x-b.Min.X)*size:], at(x, y))
+		}
+		if _, err := w.Write(row); err != nil {
+			return RawHeader{}, fmt.Errorf("writing row %d: %w", y, err)
+		}
+	}
+	return hdr, nil
+}
+
+// rawDType returns the NumPy type string of the little-endian samples of
+// the gray color model m.
+func rawDType(m color.Model) string {
+	switch m.(type) {
+	case scicolor.GrayU8Model:
+		return "|u1"
+	case scicolor.GrayS8Model:
+		return "|i1"
+	case scicolor.GrayU16Model:
+		return "<u2"
+	case scicolor.GrayS16Model:
+		return "<i2"
+	case GrayF64Model:
+		return "<f8"
+	}
+	return ""
+}
@@ -8,24 +8,30 @@
 package gocog
 
 import (
+	"compress/flate"
 	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
-	"io/ioutil"
 	"log"
 
 	"bytes"
 	"github.com/terrascope/gocog/lzw"
 	"github.com/terrascope/scimage"
 	"github.com/terrascope/scimage/scicolor"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/image/ccitt"
 	"math"
 	"strconv"
 )
 
 // A FormatError reports that the input is not a valid TIFF image.
+//
+// Errors returned by this package may wrap a FormatError or an
+// UnsupportedError together with some context, so callers should test
+// for them with errors.As rather than with a type assertion.
 type FormatError string
 
 func (e FormatError) Error() string {
@@ -42,8 +48,42 @@ func (e UnsupportedError) Error() string {
 
 var errNoPixels = FormatError("not enough pixel data")
 
+// A Geotransform maps pixel coordinates to the coordinates of the CRS of
+// the image, following the GDAL convention:
+//
+//	x = g[0] + px*g[1] + py*g[2]
+//	y = g[3] + px*g[4] + py*g[5]
 type Geotransform [6]float64
 
+// Forward returns the world coordinates of the pixel position (px, py).
+func (g Geotransform) Forward(px, py float64) (x, y float64) {
+	return g[0] + px*g[1] + py*g[2], g[3] + px*g[4] + py*g[5]
+}
+
+// Inverse returns the pixel position of the world coordinates (x, y).
+func (g Geotransform) Inverse(x, y float64) (px, py float64, err error) {
+	det := g[1]*g[5] - g[2]*g[4]
+	if det == 0 {
+		return 0, 0, fmt.Errorf("geotransform %v is not invertible", g)
+	}
+	dx, dy := x-g[0], y-g[3]
+	return (dx*g[5] - dy*g[2]) / det, (dy*g[1] - dx*g[4]) / det, nil
+}
+
+// pixelIsPoint returns the geotransform mapping pixel corners of a raster
+// whose georeferencing g maps pixel centres.
+func (g Geotransform) pixelIsPoint() Geotransform {
+	g[0] -= 0.5*g[1] + 0.5*g[2]
+	g[3] -= 0.5*g[4] + 0.5*g[5]
+	return g
+}
+
+// scale returns the geotransform of an image whose pixels are xScale by
+// yScale times larger than those of the image described by g.
+func (g Geotransform) scale(xScale, yScale float64) Geotransform {
+	return Geotransform{g[0], g[1] * xScale, g[2] * yScale, g[3], g[4] * xScale, g[5] * yScale}
+}
+
 // minInt returns the smaller of x or y.
 func minInt(a, b int) int {
 	if a <= b {
@@ -52,6 +92,35 @@ func minInt(a, b int) int {
 	return b
 }
 
+// maxInt returns the larger of x or y.
+func maxInt(a, b int) int {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
+// minInt64 returns the smaller of a or b.
+func minInt64(a, b int64) int64 {
+	if a <= b {
+		return a
+	}
+	return b
+}
+
+// maxInt64 returns the larger of a or b.
+func maxInt64(a, b int64) int64 {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
+// ceilDiv returns a/b rounded up, for non-negative a and positive b.
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
 type Overview struct {
 	Size [2]uint32 `json:"size"`
 }
@@ -76,33 +145,45 @@ func (g GeoInfo) Geotransform(level int) (Geotransform, error) {
 	}
 
 	ovr := g.Overviews[level]
-	xScale := float64(g.Size[0]/ovr.Size[0])
-	yScale := float64(g.Size[1]/ovr.Size[1])
-	geot := g.GeoTrans
+	xScale := float64(g.Size[0]) / float64(ovr.Size[0])
+	yScale := float64(g.Size[1]) / float64(ovr.Size[1])
 
-	return Geotransform{geot[0], geot[1]*xScale, 0, geot[3], 0, geot[5]*yScale}, nil
+	return g.GeoTrans.scale(xScale, yScale), nil
 }
 
-// TODO: Does cog need to support stripped files?
-// TODO: stripped files are not implemented for the moment
-
 type GeoTIFF struct {
 	kEntries     []KeyEntry
+	// kDir holds the whole GeoKeyDirectory, which may store key values.
+	kDir         []uint16
 	dParams      []float64
 	aParams      string
 	Overviews    []ImgDesc
 	GeoTrans Geotransform
+	// hasGeoTrans tells whether GeoTrans was read from the file, either
+	// from a ModelTransformation or from a tiepoint and pixel scale.
+	hasGeoTrans  bool
 	NoData       float64
+	// hasNoData tells whether NoData was read from the GDAL_NODATA tag.
+	hasNoData    bool
 	GDALMetadata string
+	Metadata     Metadata
+	// metadataErr records a malformed metadata value, which does not
+	// prevent decoding the image.
+	metadataErr error
 }
 
 
-func (g GeoTIFF) Proj4() (string, error) {
-	if g.dParams == nil || g.aParams == "" {
-		return "", fmt.Errorf("cannot process CRS data")
+// geoData parses the GeoKeys of the file. The GeoDoubleParams and
+// GeoAsciiParams tags are only needed by the keys stored in them.
+func (g GeoTIFF) geoData() (GeoData, error) {
+	if g.kEntries == nil {
+		return GeoData{}, fmt.Errorf("cannot process CRS data")
 	}
+	return parseGeoKeyDirectory(g.kEntries, g.kDir, g.dParams, g.aParams)
+}
 
-	geo, err := parseGeoKeyDirectory(g.kEntries, g.dParams, g.aParams)
+func (g GeoTIFF) Proj4() (string, error) {
+	geo, err := g.geoData()
 	if err != nil {
 		return "", err
 	}
@@ -125,35 +206,349 @@ type ImgDesc struct {
 	Predictor          uint16
 	Compression        uint16
 	SamplesPerPixel    uint16
+	PlanarConfig       uint16
+	FillOrder          uint16
 	BitsPerSample      []uint16
 	SampleFormat       []uint16
-	TileOffsets        []uint32
-	TileByteCounts     []uint32
+	SMinSampleValue    []float64
+	SMaxSampleValue    []float64
+	ColorMap           []uint16
+	// ExtraSamples describes the samples following the color ones: 0 for
+	// unspecified data, 1 for premultiplied alpha and 2 for straight alpha.
+	ExtraSamples []uint16
+	// ReferenceBlackWhite holds the reference black and white levels of
+	// each of the three components, as pairs, or is nil if absent.
+	ReferenceBlackWhite []float64
+	// JPEGTables holds the quantization and Huffman tables shared by the
+	// tiles of JPEG compressed images, as an abbreviated JPEG stream.
+	JPEGTables []byte
+	// YCbCrSubSampling holds the horizontal and vertical subsampling
+	// factors of the chroma components of YCbCr images.
+	YCbCrSubSampling [2]uint16
+	// YCbCrPositioning is 1 when chroma samples are centered on the luma
+	// ones they cover and 2 when cosited with the first.
+	YCbCrPositioning uint16
+	// DocumentName and PageName label the pages of multi-page files.
+	DocumentName   string
+	PageName       string
+	TileOffsets    []uint32
+	TileByteCounts []uint32
+
+	// subIFDs holds the offsets of the IFDs this one points to through the
+	// SubIFDs tag, usually its overviews.
+	subIFDs []int64
+	// geo holds the georeferencing of IFDs other than the first that carry
+	// their own. Overviews usually do not, and inherit that of the file.
+	geo *GeoTIFF
+	// stripped is set for images stored in strips, which are described as
+	// tiles spanning the width of the image, RowsPerStrip high. The last
+	// strip holds the remaining rows only.
+	stripped bool
+}
+
+// tileLocation returns the offset and length in bytes of tile, checking
+// that both TileOffsets and TileByteCounts describe it.
+func (cfg ImgDesc) tileLocation(tile int) (offset, n int64, err error) {
+	if tile < 0 || tile >= len(cfg.TileOffsets) {
+		return 0, 0, FormatError(fmt.Sprintf("TileOffsets has %d entries, too short for tile %d", len(cfg.TileOffsets), tile))
+	}
+	if tile >= len(cfg.TileByteCounts) {
+		return 0, 0, FormatError(fmt.Sprintf("TileByteCounts has %d entries, too short for tile %d", len(cfg.TileByteCounts), tile))
+	}
+	return int64(cfg.TileOffsets[tile]), int64(cfg.TileByteCounts[tile]), nil
+}
+
+// blockRows returns the number of rows stored in tile, which is the tile
+// height but for the last strip of stripped images.
+func (cfg ImgDesc) blockRows(tile int) int {
+	th := int(cfg.TileHeight)
+	if !cfg.stripped || th == 0 {
+		return th
+	}
+	strips := ceilDiv(int(cfg.ImageHeight), th)
+	return minInt(th, int(cfg.ImageHeight)-tile%strips*th)
+}
+
+// tileSize returns the size in bytes of an uncompressed tile, whose rows
+// are padded to whole bytes.
+func (cfg ImgDesc) tileSize() int {
+	spp := int(cfg.SamplesPerPixel)
+	if spp == 0 || cfg.PlanarConfig == 2 {
+		spp = 1
+	}
+	if h, v := int(cfg.YCbCrSubSampling[0]), int(cfg.YCbCrSubSampling[1]); cfg.PhotometricInterpr == pYCbCr && spp == 3 && h > 0 && v > 0 {
+		// Each block of h by v pixels stores its Y samples and the Cb and
+		// Cr ones they share.
+		return ceilDiv(int(cfg.TileWidth), h) * ceilDiv(int(cfg.TileHeight), v) * (h*v + 2) * int(cfg.BitsPerSample[0]) / 8
+	}
+	return int(cfg.TileHeight) * ((int(cfg.TileWidth)*spp*int(cfg.BitsPerSample[0]) + 7) / 8)
+}
+
+// DefaultMaxPixels is the maximum number of pixels of an image decoded by a
+// Reader when Options.MaxPixels is not set. The package-level Decode
+// functions, which take no Options, have no limit.
+const DefaultMaxPixels = 1 << 28
+
+// Options are the decoding parameters.
+type Options struct {
+	// MaxPixels is the maximum number of pixels an image decoded by a
+	// Reader may have. Requests exceeding it fail before any allocation
+	// takes place. If zero, DefaultMaxPixels is used.
+	MaxPixels int64
+
+	// RawDeflateFallback makes the decoder accept Deflate tiles that fail
+	// to decompress when their length matches that of an uncompressed
+	// tile, as written by some buggy producers. The raw bytes are used
+	// instead and a warning is logged.
+	RawDeflateFallback bool
+
+	// AutoRange sets the range of the color model of decoded images to
+	// the smallest and largest sample values found in the level, instead
+	// of the full range of the sample type. This requires decoding the
+	// whole level once per decode, so it is best used on overviews.
+	AutoRange bool
+
+	// Prefetch is the number of tiles read ahead in the background while
+	// earlier ones are being decompressed, overlapping I/O and decoding on
+	// slow or remote readers. It has no effect on inputs that do not
+	// implement io.ReaderAt. If zero, tiles are read as they are decoded.
+	Prefetch int
+
+	// HeaderBytes is the size of the first read of the file when a Reader
+	// is created, from which its IFDs are parsed. Should they extend past
+	// it, it is grown in one read, up to a few megabytes, so the header of
+	// a remote COG takes one or a few round trips rather than one per IFD.
+	// If zero, DefaultHeaderBytes is used, and if negative the IFDs are
+	// read from the source directly. It has no effect on inputs that do
+	// not implement io.ReaderAt.
+	HeaderBytes int
+
+	// FullLevel makes sub-image decodes return an image with the bounds of
+	// the whole level, where only the pixels of the requested rectangle are
+	// set, instead of one with the bounds of the rectangle. Either way
+	// pixels are addressed in the coordinates of the level.
+	FullLevel bool
+
+	// ColorMapBits forces the ColorMap of paletted images to be read as
+	// 8 or 16-bit values. If zero, 8-bit values are assumed when none of
+	// them exceeds 255, rescuing files that do not follow the spec.
+	ColorMapBits int
+
+	// AlphaMode selects how the alpha sample of RGBA images is returned,
+	// regardless of the ExtraSamples declaration of the file.
+	AlphaMode AlphaMode
+
+	// Progress, if not nil, is called after each tile is decoded with the
+	// number of tiles decoded so far and the number of tiles the request
+	// reads.
+	Progress func(done, total int)
+
+	// TileAligned makes sub-image decodes return an image covering whole
+	// tiles, extending the requested rectangle to the tile grid. The
+	// padding of the tiles beyond the image is set to PadValue.
+	TileAligned bool
+	PadValue    float64
+
+	// CheckByteOrder makes NewReader run Reader.ByteOrderSuspect on the
+	// full resolution image, logging a warning if its samples look like
+	// they are in the wrong byte order.
+	CheckByteOrder bool
+
+	// NoDataToNaN makes floating point decodes return NaN for the samples
+	// equal to the GDAL_NODATA value of the file.
+	NoDataToNaN bool
+
+	// StrictTileSize makes tiles that decompress to more bytes than a tile
+	// holds fail to decode, as the excess points to corrupt data or a
+	// wrong predictor. Decompression then stops as soon as the excess is
+	// found, which bounds the memory a decompression bomb can take. By
+	// default a warning is logged and the excess is ignored.
+	StrictTileSize bool
+
+	// ForceColorModel, if not nil, replaces the color model derived from
+	// the tags of the file, to rescue mislabeled files such as signed data
+	// marked as unsigned. It must be a gray model of this package or of
+	// scimage, or a color.Palette, whose samples are as wide as those of
+	// the file.
+	ForceColorModel color.Model
+
+	// DisplayMin and DisplayMax, when DisplayMin is less than DisplayMax,
+	// set the range of the color model of decoded gray images, so that
+	// images decoded from different files or levels of a dataset render
+	// alike. They take precedence over the SMinSampleValue and
+	// SMaxSampleValue tags and over AutoRange, and are clamped to the
+	// range of the sample type.
+	DisplayMin, DisplayMax float64
+
+	// SampleTransform, if not nil, is applied to each sample as it is
+	// decoded, such as to log-scale radar data or apply a gamma curve.
+	// Samples of integer images are rounded and clamped to the range of
+	// their type afterwards, NaN results giving 0. The indices of paletted
+	// images are left untouched. NoDataToNaN applies first.
+	SampleTransform func(v float64) float64
+
+	// OverviewWorkers is the number of goroutines BuildOverviews computes
+	// each overview with. If zero or one, they are computed sequentially.
+	OverviewWorkers int
+
+	// TileIndex, if not nil, maps the column i and row j of a tile, in a
+	// grid of across by down tiles, to its index in the TileOffsets and
+	// TileByteCounts of a plane, for files storing their tiles in an order
+	// other than the row-major one of the spec, such as column-major or
+	// Morton order.
+	TileIndex func(i, j, across, down int) int
+
+	// TagHandler, if not nil, is called while parsing each IFD with the
+	// tags this package does not interpret, such as private ones. raw
+	// holds the value of the tag in the byte order of the file, or is nil
+	// if it cannot be read.
+	TagHandler func(tag uint16, datatype uint16, count uint32, raw []byte)
+
+	// SkipBadIFDs makes NewReader log and leave out the IFDs that fail to
+	// parse, such as broken overviews, instead of failing, so the levels
+	// that parse can still be decoded. Levels are then numbered among
+	// those kept.
+	SkipBadIFDs bool
+}
+
+// An AlphaMode is the representation of the alpha sample in decoded RGBA
+// images.
+type AlphaMode int
+
+const (
+	// AlphaAsStored returns an image.RGBA for premultiplied alpha and an
+	// image.NRGBA otherwise, following the ExtraSamples tag.
+	AlphaAsStored AlphaMode = iota
+	// AlphaPremultiplied always returns an image.RGBA.
+	AlphaPremultiplied
+	// AlphaStraight always returns an image.NRGBA.
+	AlphaStraight
+)
+
+// maxPixels returns the limit on the pixels of decoded images. Decoders
+// without options, those of the package-level functions, have none.
+func (o *Options) maxPixels() int64 {
+	switch {
+	case o == nil:
+		return math.MaxInt64
+	case o.MaxPixels == 0:
+		return DefaultMaxPixels
+	}
+	return o.MaxPixels
 }
 
 type decoder struct {
-	buf []byte
-	ra  io.ReaderAt
-	bo  binary.ByteOrder
-	gt  GeoTIFF
+	buf  []byte
+	ra   io.ReaderAt
+	bo   binary.ByteOrder
+	gt   GeoTIFF
+	opts *Options
+
+	flight *tileFlight
+	ranges *levelRanges
+	// costs, if not nil, collects the cost of each tile decoded.
+	costs *[]TileCost
 }
 
 func newDecoder(r io.Reader) (decoder, error) {
-	ra := newReaderAt(r)
+	return newDecoderAt(newReaderAt(r))
+}
+
+// newDecoderAt returns a decoder for the TIFF in ra, after checking its
+// header.
+func newDecoderAt(ra io.ReaderAt) (decoder, error) {
 	p := make([]byte, 8)
 	if _, err := ra.ReadAt(p, 0); err != nil {
 		return decoder{}, FormatError("malformed header 1")
 	}
 	switch string(p[0:4]) {
 	case leHeader:
-		return decoder{nil, ra, binary.LittleEndian, GeoTIFF{}}, nil
+		return decoder{ra: ra, bo: binary.LittleEndian, flight: newTileFlight(), ranges: newLevelRanges()}, nil
 	case beHeader:
-		return decoder{nil, ra, binary.BigEndian, GeoTIFF{}}, nil
+		return decoder{ra: ra, bo: binary.BigEndian, flight: newTileFlight(), ranges: newLevelRanges()}, nil
 	}
 
 	return decoder{}, FormatError("malformed header 2")
 }
 
+// entryData returns the raw value of the IFD entry e, reading it from the
+// file when it does not fit in the entry itself.
+func (d *decoder) entryData(e []byte, datatype uint16, count uint32) ([]byte, error) {
+	if int(datatype) >= len(lengths) {
+		return nil, FormatError(fmt.Sprintf("data type: %d not recognised", datatype))
+	}
+	datalen := int64(lengths[datatype]) * int64(count)
+	if datalen <= 4 {
+		return e[8 : 8+datalen], nil
+	}
+	// The IFD contains a pointer to the real value.
+	raw := make([]byte, datalen)
+	if _, err := d.ra.ReadAt(raw, int64(d.bo.Uint32(e[8:12]))); err != nil {
+		return nil, FormatError("error reading IFD entry data")
+	}
+	return raw, nil
+}
+
+// shorts decodes raw as a sequence of uint16 values.
+func (d *decoder) shorts(raw []byte) []uint16 {
+	data := make([]uint16, len(raw)/2)
+	for i := range data {
+		data[i] = d.bo.Uint16(raw[2*i : 2*(i+1)])
+	}
+	return data
+}
+
+// numbers decodes raw as a sequence of numeric values of the given data
+// type, signed or not, converted to float64.
+func (d *decoder) numbers(raw []byte, datatype uint16) ([]float64, error) {
+	if int(datatype) >= len(lengths) || lengths[datatype] == 0 || datatype == dtASCII {
+		return nil, FormatError(fmt.Sprintf("numeric data type: %d not recognised", datatype))
+	}
+	size := int(lengths[datatype])
+	data := make([]float64, len(raw)/size)
+	for i := range data {
+		b := raw[size*i : size*(i+1)]
+		switch datatype {
+		case dtByte:
+			data[i] = float64(b[0])
+		case dtInt8:
+			data[i] = float64(int8(b[0]))
+		case dtShort:
+			data[i] = float64(d.bo.Uint16(b))
+		case dtInt16:
+			data[i] = float64(int16(d.bo.Uint16(b)))
+		case dtLong:
+			data[i] = float64(d.bo.Uint32(b))
+		case dtInt32:
+			data[i] = float64(int32(d.bo.Uint32(b)))
+		case dtRational:
+			data[i] = float64(d.bo.Uint32(b[:4])) / float64(d.bo.Uint32(b[4:]))
+		case dtSRational:
+			data[i] = float64(int32(d.bo.Uint32(b[:4]))) / float64(int32(d.bo.Uint32(b[4:])))
+		case dtFloat32:
+			data[i] = float64(math.Float32frombits(d.bo.Uint32(b)))
+		case dtFloat64:
+			data[i] = math.Float64frombits(d.bo.Uint64(b))
+		}
+	}
+	return data, nil
+}
+
+// signed reinterprets in place the values of an unsigned integer datatype
+// in data as two's complement signed ones of the same width.
+func signed(data []float64, datatype uint16) {
+	for i, v := range data {
+		switch datatype {
+		case dtByte:
+			data[i] = float64(int8(uint8(v)))
+		case dtShort:
+			data[i] = float64(int16(uint16(v)))
+		case dtLong:
+			data[i] = float64(int32(uint32(v)))
+		}
+	}
+}
+
 // parseIFD decides whether the IFD entry in p is "interesting" and
 // stows away the data in the decoder. It returns the tag number of the
 // entry and an error, if any.
@@ -171,10 +566,25 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 	}
 	var pixelScale []float64
 	var tiePoint []float64
-
-	imgDesc := ImgDesc{SampleFormat: []uint16{1}, Predictor: 1}
+	var modelTransform []float64
+
+	// Tags other than the dimensions and the location of the data may be
+	// omitted, in which case the defaults of the spec apply.
+	imgDesc := ImgDesc{SampleFormat: []uint16{1}, SamplesPerPixel: 1, Predictor: 1, PlanarConfig: 1, FillOrder: 1,
+		BitsPerSample: []uint16{1}, Compression: cNone, PhotometricInterpr: pBlackIsZero,
+		YCbCrSubSampling: [2]uint16{2, 2}, YCbCrPositioning: 1}
+	hasPhotometric := false
+	var stripOffsets, stripByteCounts []uint32
+	var rowsPerStrip uint32
 	var nonCaptTags []uint16
 
+	// The georeferencing of the first IFD is that of the file. Any found
+	// in later ones is kept with their ImgDesc.
+	geo := &d.gt
+	if len(d.gt.Overviews) > 0 {
+		geo = &GeoTIFF{}
+	}
+
 	for i := 0; i < len(ifd); i += ifdLen {
 		tag := d.bo.Uint16(ifd[i : i+2])
 		datatype := d.bo.Uint16(ifd[i+2 : i+4])
@@ -214,7 +624,11 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			if datatype != dtShort {
 				return 0, FormatError(fmt.Sprintf("BitsPerSample type: %v not recognised", datatype))
 			}
-			imgDesc.BitsPerSample = []uint16{d.bo.Uint16(ifd[i+8 : i+10])}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			imgDesc.BitsPerSample = d.shorts(raw)
 		case cCompression:
 			if datatype != dtShort || count != 1 {
 				return 0, FormatError(fmt.Sprintf("Compression type: %v or count: %d not recognised", datatype, count))
@@ -225,6 +639,12 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 				return 0, FormatError(fmt.Sprintf("PhotometricInterpretation type: %v or count: %d not recognised", datatype, count))
 			}
 			imgDesc.PhotometricInterpr = d.bo.Uint16(ifd[i+8 : i+10])
+			hasPhotometric = true
+		case cFillOrder:
+			if datatype != dtShort || count != 1 {
+				return 0, FormatError(fmt.Sprintf("FillOrder type: %v or count: %d not recognised", datatype, count))
+			}
+			imgDesc.FillOrder = d.bo.Uint16(ifd[i+8 : i+10])
 		case cSamplesPerPixel:
 			if datatype != dtShort || count != 1 {
 				return 0, FormatError(fmt.Sprintf("SamplesPerPixel type: %v or count: %d not recognised", datatype, count))
@@ -234,22 +654,57 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			if datatype != dtShort {
 				return 0, FormatError(fmt.Sprintf("SampleFormat type: %v not recognised", datatype))
 			}
-			pConf := d.bo.Uint16(ifd[i+8 : i+10])
-			if pConf != 1 {
-				return 0, fmt.Errorf("Planar configuration other then 'chunky' has not been implemented: %d", pConf)
+			imgDesc.PlanarConfig = d.bo.Uint16(ifd[i+8 : i+10])
+			if imgDesc.PlanarConfig != 1 && imgDesc.PlanarConfig != 2 {
+				return 0, FormatError(fmt.Sprintf("PlanarConfiguration: %d not recognised", imgDesc.PlanarConfig))
 			}
 		case cSampleFormat:
 			if datatype != dtShort {
 				return 0, FormatError(fmt.Sprintf("SampleFormat type: %v not recognised", datatype))
 			}
-			imgDesc.SampleFormat = []uint16{d.bo.Uint16(ifd[i+8 : i+10])}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			imgDesc.SampleFormat = d.shorts(raw)
+		case cSMinSampleValue, cSMaxSampleValue:
+			// The type of these tags follows the SampleFormat of the image,
+			// so signed and floating point values are valid here.
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			data, err := d.numbers(raw, datatype)
+			if err != nil {
+				return 0, err
+			}
+			// Some writers store the range of signed images as
+			// unsigned values of the same width, which then carry the
+			// sign of the samples. SampleFormat precedes these tags.
+			if len(imgDesc.SampleFormat) > 0 && sampleFormat(imgDesc.SampleFormat[0]) == sintSample {
+				signed(data, datatype)
+			}
+			if tag == cSMinSampleValue {
+				imgDesc.SMinSampleValue = data
+			} else {
+				imgDesc.SMaxSampleValue = data
+			}
+		case cColorMap:
+			if datatype != dtShort || count%3 != 0 {
+				return 0, FormatError(fmt.Sprintf("ColorMap type: %v or count: %d not recognised", datatype, count))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			imgDesc.ColorMap = d.shorts(raw)
 		case cPredictor:
 			if datatype != dtShort {
 				return 0, FormatError(fmt.Sprintf("SampleFormat type: %v not recognised", datatype))
 			}
 			imgDesc.Predictor = d.bo.Uint16(ifd[i+8 : i+10])
-			if imgDesc.Predictor != 1 && imgDesc.Predictor != 2 {
-				return 0, fmt.Errorf("Predictor other then 1=None or 2=Horizontal not implemented: %v", imgDesc.Predictor)
+			if imgDesc.Predictor < prNone || imgDesc.Predictor > prFloatingPoint {
+				return 0, UnsupportedError(fmt.Sprintf("Predictor other then 1=None, 2=Horizontal or 3=FloatingPoint: %v", imgDesc.Predictor))
 			}
 		case cTileWidth:
 			if count != 1 {
@@ -275,6 +730,39 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			default:
 				return 0, FormatError(fmt.Sprintf("TileLength type: %v not recognised", datatype))
 			}
+		case cStripOffsets, cStripByteCounts:
+			if datatype != dtShort && datatype != dtLong {
+				return 0, FormatError(fmt.Sprintf("StripOffsets or StripByteCounts type: %v not recognised", datatype))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			data := make([]uint32, count)
+			for k := range data {
+				if datatype == dtShort {
+					data[k] = uint32(d.bo.Uint16(raw[2*k:]))
+				} else {
+					data[k] = d.bo.Uint32(raw[4*k:])
+				}
+			}
+			if tag == cStripOffsets {
+				stripOffsets = data
+			} else {
+				stripByteCounts = data
+			}
+		case cRowsPerStrip:
+			if count != 1 {
+				return 0, FormatError(fmt.Sprintf("RowsPerStrip count: %d not recognised", count))
+			}
+			switch datatype {
+			case dtShort:
+				rowsPerStrip = uint32(d.bo.Uint16(ifd[i+8 : i+10]))
+			case dtLong:
+				rowsPerStrip = d.bo.Uint32(ifd[i+8 : i+12])
+			default:
+				return 0, FormatError(fmt.Sprintf("RowsPerStrip type: %v not recognised", datatype))
+			}
 		case cTileOffsets, cTileByteCounts:
 			if datatype != dtLong {
 				return 0, FormatError(fmt.Sprintf("TileOffsets or TileByteCounts type: %v not recognised", datatype))
@@ -305,18 +793,19 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			raw := make([]byte, int(count)*8)
 			d.ra.ReadAt(raw, int64(d.bo.Uint32(ifd[i+8:i+12])))
 
-			d.gt.dParams = make([]float64, count)
+			geo.dParams = make([]float64, count)
 			for i := uint32(0); i < count; i++ {
-				d.gt.dParams[i] = math.Float64frombits(d.bo.Uint64(raw[8*i : 8*(i+1)]))
+				geo.dParams[i] = math.Float64frombits(d.bo.Uint64(raw[8*i : 8*(i+1)]))
 			}
 		case GeoAsciiParamsTag:
 			if datatype != dtASCII {
 				return 0, FormatError(fmt.Sprintf("GeogASCIIParamsTag type: %v not recognised", datatype))
 			}
-			// The IFD contains a pointer to the real value.
-			raw := make([]byte, int(count))
-			d.ra.ReadAt(raw, int64(d.bo.Uint32(ifd[i+8:i+12])))
-			d.gt.aParams = string(raw)
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			geo.aParams = string(raw)
 		case tGeoKeyDirectory:
 			if datatype != dtShort || count < 4 {
 				return 0, FormatError(fmt.Sprintf("GeoKeyDirectory type: %v or count: %d not recognised", datatype, count))
@@ -336,12 +825,13 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			}
 			numKeys := int(data[3])
 
-			d.gt.kEntries = make([]KeyEntry, numKeys)
+			geo.kDir = data
+			geo.kEntries = make([]KeyEntry, numKeys)
 			for i := 0; i < numKeys; i++ {
-				d.gt.kEntries[i].KeyID = data[4*(i+1)]
-				d.gt.kEntries[i].TIFFTagLocation = data[4*(i+1)+1]
-				d.gt.kEntries[i].Count = data[4*(i+1)+2]
-				d.gt.kEntries[i].ValueOffset = data[4*(i+1)+3]
+				geo.kEntries[i].KeyID = data[4*(i+1)]
+				geo.kEntries[i].TIFFTagLocation = data[4*(i+1)+1]
+				geo.kEntries[i].Count = data[4*(i+1)+2]
+				geo.kEntries[i].ValueOffset = data[4*(i+1)+3]
 			}
 		case tModelPixelScale:
 			if datatype != dtFloat64 || count != 3 {
@@ -368,7 +858,16 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 				tiePoint[i] = math.Float64frombits(d.bo.Uint64(raw[8*i : 8*(i+1)]))
 			}
 		case tModelTransformation:
-			return 0, fmt.Errorf("time to implement ModelTransformation, this file uses it")
+			if datatype != dtFloat64 || count != 16 {
+				return 0, FormatError(fmt.Sprintf("ModelTransformation type: %v or count: %d not recognised", datatype, count))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			if modelTransform, err = d.numbers(raw, datatype); err != nil {
+				return 0, err
+			}
 		case tGDALNoData:
 			if datatype != dtASCII {
 				return 0, FormatError(fmt.Sprintf("GDALNoDataTag type: %v not recognised", datatype))
@@ -381,6 +880,84 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			if err != nil {
 				return 0, FormatError(fmt.Sprintf("GDAL NoData value %s cannot be parsed: %v", string(raw), err))
 			}
+			d.gt.hasNoData = true
+		case cExtraSamples:
+			if datatype != dtShort {
+				return 0, FormatError(fmt.Sprintf("ExtraSamples type: %v not recognised", datatype))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			imgDesc.ExtraSamples = d.shorts(raw)
+		case cReferenceBlackWhite:
+			if count != 6 {
+				return 0, FormatError(fmt.Sprintf("ReferenceBlackWhite count: %d not recognised", count))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			if imgDesc.ReferenceBlackWhite, err = d.numbers(raw, datatype); err != nil {
+				return 0, err
+			}
+		case cJPEGTables:
+			if datatype != dtUndefined {
+				return 0, FormatError(fmt.Sprintf("JPEGTables type: %v not recognised", datatype))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			imgDesc.JPEGTables = append([]byte(nil), raw...)
+		case cYCbCrSubSampling:
+			if datatype != dtShort || count != 2 {
+				return 0, FormatError(fmt.Sprintf("YCbCrSubSampling type: %v or count: %d not recognised", datatype, count))
+			}
+			imgDesc.YCbCrSubSampling[0] = d.bo.Uint16(ifd[i+8 : i+10])
+			imgDesc.YCbCrSubSampling[1] = d.bo.Uint16(ifd[i+10 : i+12])
+		case cYCbCrPositioning:
+			if datatype != dtShort || count != 1 {
+				return 0, FormatError(fmt.Sprintf("YCbCrPositioning type: %v or count: %d not recognised", datatype, count))
+			}
+			imgDesc.YCbCrPositioning = d.bo.Uint16(ifd[i+8 : i+10])
+		case cSubIFDs:
+			if datatype != dtLong && datatype != dtIFD {
+				return 0, FormatError(fmt.Sprintf("SubIFDs type: %v not recognised", datatype))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			for j := 0; j+4 <= len(raw); j += 4 {
+				imgDesc.subIFDs = append(imgDesc.subIFDs, int64(d.bo.Uint32(raw[j:j+4])))
+			}
+		case cDocumentName, cPageName:
+			if datatype != dtASCII {
+				return 0, FormatError(fmt.Sprintf("ASCII tag %d type: %v not recognised", tag, datatype))
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			if name := string(bytes.TrimRight(raw, "\x00")); tag == cDocumentName {
+				imgDesc.DocumentName = name
+			} else {
+				imgDesc.PageName = name
+			}
+		case cImageDescription, cSoftware, cDateTime:
+			if datatype != dtASCII {
+				return 0, FormatError(fmt.Sprintf("ASCII tag %d type: %v not recognised", tag, datatype))
+			}
+			// Only the descriptive tags of the first image are kept.
+			if len(d.gt.Overviews) > 0 {
+				break
+			}
+			raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count)
+			if err != nil {
+				return 0, err
+			}
+			d.gt.setMetadata(tag, string(bytes.TrimRight(raw, "\x00")))
 		case tGDALMetadata:
 			if datatype != dtASCII {
 				return 0, FormatError(fmt.Sprintf("GDALMetadataTag type: %v not recognised", datatype))
@@ -391,21 +968,64 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 			d.gt.GDALMetadata = string(bytes.Trim(raw, "\x00"))
 		default:
 			nonCaptTags = append(nonCaptTags, tag)
+			if d.opts != nil && d.opts.TagHandler != nil {
+				// The handler gets its own copy, so it cannot alter
+				// the buffered file.
+				var val []byte
+				if raw, err := d.entryData(ifd[i:i+ifdLen], datatype, count); err == nil {
+					val = append([]byte(nil), raw...)
+				}
+				d.opts.TagHandler(tag, datatype, count, val)
+			}
 		}
 	}
 	log.Println("non captured tag:", nonCaptTags)
 
-	if tiePoint != nil {
-		d.gt.GeoTrans[0] = tiePoint[3]
-		d.gt.GeoTrans[1] = tiePoint[0]
-		d.gt.GeoTrans[3] = tiePoint[4]
-		d.gt.GeoTrans[5] = tiePoint[1]
+	// PhotometricInterpretation has no default, so guess it from the
+	// number of samples as libtiff does.
+	if !hasPhotometric && imgDesc.SamplesPerPixel >= 3 {
+		imgDesc.PhotometricInterpr = pRGB
+	}
+
+	// Strips are decoded as tiles spanning the width of the image. The
+	// default RowsPerStrip makes the whole image a single strip.
+	if imgDesc.TileWidth == 0 && stripOffsets != nil {
+		imgDesc.TileWidth, imgDesc.TileHeight = imgDesc.ImageWidth, imgDesc.ImageHeight
+		if rowsPerStrip != 0 && rowsPerStrip < imgDesc.ImageHeight {
+			imgDesc.TileHeight = rowsPerStrip
+		}
+		imgDesc.TileOffsets, imgDesc.TileByteCounts = stripOffsets, stripByteCounts
+		imgDesc.stripped = true
 	}
-	if pixelScale != nil {
-		d.gt.GeoTrans[1] = pixelScale[0]
-		d.gt.GeoTrans[5] = -1 * pixelScale[1]
+	if err := imgDesc.checkCodecTags(); err != nil {
+		return 0, err
+	}
+
+	// ModelTransformation takes precedence as it is the only way to
+	// describe rotated or sheared rasters.
+	if modelTransform != nil {
+		m := modelTransform
+		geo.GeoTrans = Geotransform{m[3], m[0], m[1], m[7], m[4], m[5]}
+		geo.hasGeoTrans = true
+	} else {
+		if tiePoint != nil {
+			geo.GeoTrans[0] = tiePoint[3]
+			geo.GeoTrans[1] = tiePoint[0]
+			geo.GeoTrans[3] = tiePoint[4]
+			geo.GeoTrans[5] = tiePoint[1]
+		}
+		if pixelScale != nil {
+			geo.GeoTrans[1] = pixelScale[0]
+			geo.GeoTrans[5] = -1 * pixelScale[1]
+		}
+		if tiePoint != nil && pixelScale != nil {
+			geo.hasGeoTrans = true
+		}
 	}
 
+	if geo != &d.gt && (geo.kEntries != nil || geo.hasGeoTrans) {
+		imgDesc.geo = geo
+	}
 	d.gt.Overviews = append(d.gt.Overviews, imgDesc)
 
 	nextIFDOffset := ifdOffset + int64(2) + int64(numItems*12)
@@ -413,37 +1033,166 @@ func (d *decoder) parseIFD(ifdOffset int64) (int64, error) {
 		return 0, FormatError("error reading IFD")
 	}
 	ifdOffset = int64(d.bo.Uint32(p[:4]))
+	if err := d.checkIFDOffset(ifdOffset); err != nil {
+		return 0, err
+	}
 
 	return ifdOffset, nil
 }
 
+// checkIFDOffset verifies that an IFD offset read from the file points past
+// the header and, when the size of the input is known, inside the file.
+// A zero offset terminates the IFD chain and is always valid.
+func (d *decoder) checkIFDOffset(off int64) error {
+	if off == 0 {
+		return nil
+	}
+	if off < 8 {
+		return FormatError(fmt.Sprintf("IFD offset %d overlaps the header", off))
+	}
+	if size, ok := readerSize(d.ra); ok && off+2 > size {
+		return FormatError(fmt.Sprintf("IFD offset %d beyond end of file (%d bytes)", off, size))
+	}
+	return nil
+}
+
+// checkCodecTags verifies that the tags the compression and photometric
+// interpretation of cfg depend on are present and consistent, so no codec
+// has to find out while decoding.
+func (cfg ImgDesc) checkCodecTags() error {
+	switch cfg.Compression {
+	case cJPEG:
+		for _, b := range cfg.BitsPerSample {
+			if b != 8 && b != 12 {
+				return FormatError(fmt.Sprintf("JPEG compression with %d bits per sample", b))
+			}
+		}
+		// The tables are optional, each tile then carrying its own, but
+		// when present they must form an abbreviated JPEG stream.
+		if t := cfg.JPEGTables; t != nil {
+			if len(t) < 4 || t[0] != 0xff || t[1] != 0xd8 || t[len(t)-2] != 0xff || t[len(t)-1] != 0xd9 {
+				return FormatError("JPEGTables is not a JPEG stream")
+			}
+		}
+	case cG3, cG4:
+		if len(cfg.BitsPerSample) != 1 || cfg.BitsPerSample[0] != 1 {
+			return FormatError(fmt.Sprintf("CCITT compression with BitsPerSample %v", cfg.BitsPerSample))
+		}
+	}
+
+	if cfg.PhotometricInterpr == pYCbCr {
+		if cfg.SamplesPerPixel < 3 {
+			return FormatError(fmt.Sprintf("YCbCr image with %d samples per pixel", cfg.SamplesPerPixel))
+		}
+		h, v := cfg.YCbCrSubSampling[0], cfg.YCbCrSubSampling[1]
+		if h != 1 && h != 2 && h != 4 || v != 1 && v != 2 && v != 4 || v > h {
+			return FormatError(fmt.Sprintf("YCbCrSubSampling %d,%d not recognised", h, v))
+		}
+		if p := cfg.YCbCrPositioning; p != 1 && p != 2 {
+			return FormatError(fmt.Sprintf("YCbCrPositioning %d not recognised", p))
+		}
+	}
+	return nil
+}
+
 func (d *decoder) readIFD() error {
 	var err error
 	p := make([]byte, 4)
 	if _, err = d.ra.ReadAt(p, 4); err != nil {
-		return err
+		return fmt.Errorf("reading first IFD offset: %w", err)
 	}
 	ifdOffset := int64(d.bo.Uint32(p[0:4]))
+	if err = d.checkIFDOffset(ifdOffset); err != nil {
+		return err
+	}
+
+	// With Options.SkipBadIFDs, IFDs failing to parse are logged and
+	// left out, the first error being returned only if none is left.
+	skip := d.opts != nil && d.opts.SkipBadIFDs
+	var firstErr error
+	skipped := func(off int64, err error) bool {
+		if !skip {
+			return false
+		}
+		log.Printf("skipping the IFD at offset %d: %v", off, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+		return true
+	}
 
+	// A corrupt file could link an IFD back to an earlier one, which would
+	// otherwise loop forever.
+	visited := map[int64]bool{}
 	for ifdOffset != 0 {
-		ifdOffset, err = d.parseIFD(ifdOffset)
+		if visited[ifdOffset] {
+			return FormatError(fmt.Sprintf("circular IFD chain at offset %d", ifdOffset))
+		}
+		visited[ifdOffset] = true
+		off := ifdOffset
+		ifdOffset, err = d.parseIFD(off)
 		if err != nil {
-			return err
+			if !skipped(off, err) {
+				return err
+			}
+			// Carry on with the next IFD in the chain, if it can be
+			// found.
+			if ifdOffset, err = d.nextIFDOffset(off); err != nil {
+				break
+			}
+			continue
+		}
+
+		// Overviews stored as SubIFDs follow the image they belong to.
+		for _, off := range d.gt.Overviews[len(d.gt.Overviews)-1].subIFDs {
+			if off == 0 {
+				continue
+			}
+			if visited[off] {
+				return FormatError(fmt.Sprintf("circular IFD chain at offset %d", off))
+			}
+			visited[off] = true
+			if err = d.checkIFDOffset(off); err != nil {
+				return err
+			}
+			if _, err = d.parseIFD(off); err != nil && !skipped(off, err) {
+				return err
+			}
 		}
 	}
 
+	if len(d.gt.Overviews) == 0 && firstErr != nil {
+		return firstErr
+	}
 	return nil
 }
 
+// nextIFDOffset returns the offset of the IFD following the one at off,
+// regardless of the validity of its entries.
+func (d *decoder) nextIFDOffset(off int64) (int64, error) {
+	p := make([]byte, 4)
+	if _, err := d.ra.ReadAt(p[:2], off); err != nil {
+		return 0, FormatError("error reading IFD")
+	}
+	if _, err := d.ra.ReadAt(p, off+2+ifdLen*int64(d.bo.Uint16(p[:2]))); err != nil {
+		return 0, FormatError("error reading IFD")
+	}
+	next := int64(d.bo.Uint32(p))
+	if err := d.checkIFDOffset(next); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
 func (d *decoder) dataType() (string, error) {
 	cfg := d.gt.Overviews[0]
 
 	switch sampleFormat(cfg.SampleFormat[0]) {
 	case uintSample:
 		switch cfg.BitsPerSample[0] {
-		case 8:
+		case 1, 8:
 			return "UInt8", nil
-		case 16:
+		case 12, 16:
 			return "UInt16", nil
 		}
 	case sintSample:
@@ -453,6 +1202,13 @@ func (d *decoder) dataType() (string, error) {
 		case 16:
 			return "Int16", nil
 		}
+	case ieeefpSample:
+		switch cfg.BitsPerSample[0] {
+		case 32:
+			return "Float32", nil
+		case 64:
+			return "Float64", nil
+		}
 	}
 
 	return "", fmt.Errorf("datatype not recognised")
@@ -460,131 +1216,386 @@ func (d *decoder) dataType() (string, error) {
 
 func (d *decoder) colorModel(level int) color.Model {
 	cfg := d.gt.Overviews[level]
+	if d.opts != nil && d.opts.ForceColorModel != nil {
+		return d.opts.ForceColorModel
+	}
 
 	// TODO get range in color modes dynamically from tiff file metadata?
 	switch cfg.PhotometricInterpr {
 	case pBlackIsZero:
-		switch sampleFormat(cfg.SampleFormat[0]) {
-		case uintSample:
-			switch cfg.BitsPerSample[0] {
-			case 8:
-				return scicolor.GrayU8Model{Max: 255}
-			case 16:
-				return scicolor.GrayU16Model{Max: 65535}
-			}
-		case sintSample:
-			switch cfg.BitsPerSample[0] {
-			case 8:
-				return scicolor.GrayS8Model{Min: -128, Max: 127}
-			case 16:
-				return scicolor.GrayS16Model{Min: -32768, Max: 32767}
-			}
+		return d.grayModel(cfg)
+	case pWhiteIsZero:
+		// Integer samples are inverted while decoding.
+		if sampleFormat(cfg.SampleFormat[0]) != ieeefpSample {
+			return d.grayModel(cfg)
+		}
+	case pPaletted:
+		if len(cfg.ColorMap) == 0 {
+			return nil
+		}
+		return d.palette(cfg.ColorMap)
+	case pRGB:
+		return d.rgbModel(cfg)
+	case pYCbCr:
+		// Only interleaved samples, whose chroma may be subsampled, are
+		// converted to RGB.
+		if cfg.SamplesPerPixel == 3 && cfg.PlanarConfig != 2 {
+			return d.rgbModel(cfg)
 		}
 	}
 
 	return nil
 }
 
-// decode decodes the raw data of an image.
-// It reads from d.buf and writes the strip or tile into dst.
-func (d *decoder) decode(dst image.Image, level, xmin, ymin, xmax, ymax int) error {
-	cfg := d.gt.Overviews[level]
+// checkForcedModel verifies that Options.ForceColorModel, if set, can hold
+// the samples of every level.
+func (d *decoder) checkForcedModel() error {
+	if d.opts == nil || d.opts.ForceColorModel == nil {
+		return nil
+	}
+	m := d.opts.ForceColorModel
+	size := sampleSize(m)
+	if _, ok := m.(color.Palette); ok {
+		size = 1
+	}
+	if size == 0 {
+		return UnsupportedError(fmt.Sprintf("forced color model %T", m))
+	}
+	for level, cfg := range d.gt.Overviews {
+		ok := false
+		switch bits := cfg.BitsPerSample[0]; bits {
+		case 1:
+			_, ok = m.(scicolor.GrayU8Model)
+		case 12:
+			_, ok = m.(scicolor.GrayU16Model)
+		case 32:
+			_, ok = m.(GrayF64Model)
+		default:
+			ok = int(bits) == 8*size
+		}
+		if !ok {
+			return fmt.Errorf("forced color model %T does not fit the %d-bit samples of level %d", m, cfg.BitsPerSample[0], level)
+		}
+	}
+	return nil
+}
+
+// palette returns the palette described by the ColorMap values cmap, which
+// hold all the red values followed by the green and blue ones. The spec
+// mandates 16-bit values but some files store 8-bit ones, which are
+// detected by all the values being below 256 unless Options.ColorMapBits
+// forces an interpretation.
+func (d *decoder) palette(cmap []uint16) color.Palette {
+	eightBit := true
+	for _, v := range cmap {
+		if v > 0xff {
+			eightBit = false
+			break
+		}
+	}
+	if d.opts != nil && d.opts.ColorMapBits != 0 {
+		eightBit = d.opts.ColorMapBits == 8
+	}
+
+	n := len(cmap) / 3
+	p := make(color.Palette, n)
+	for i := range p {
+		r, g, b := cmap[i], cmap[n+i], cmap[2*n+i]
+		if eightBit {
+			r, g, b = r*0x101, g*0x101, b*0x101
+		}
+		p[i] = color.RGBA64{r, g, b, 0xffff}
+	}
+	return p
+}
+
+// hasDisplayRange reports whether the options set the range of decoded
+// gray images.
+func (d *decoder) hasDisplayRange() bool {
+	return d.opts != nil && d.opts.DisplayMin < d.opts.DisplayMax
+}
+
+// grayModel is grayModel with the range set by Options.DisplayMin and
+// DisplayMax, if any.
+func (d *decoder) grayModel(cfg ImgDesc) color.Model {
+	if d.hasDisplayRange() {
+		cfg.SMinSampleValue = []float64{d.opts.DisplayMin}
+		cfg.SMaxSampleValue = []float64{d.opts.DisplayMax}
+	}
+	return grayModel(cfg)
+}
+
+// grayModel returns the color model of a single sample of the image
+// described by cfg. The range of the model is the one declared by the
+// SMinSampleValue and SMaxSampleValue tags or, if absent, the full range
+// of the sample type.
+func grayModel(cfg ImgDesc) color.Model {
+	min, max := math.Inf(-1), math.Inf(1)
+	if len(cfg.SMinSampleValue) > 0 {
+		min = cfg.SMinSampleValue[0]
+	}
+	if len(cfg.SMaxSampleValue) > 0 {
+		max = cfg.SMaxSampleValue[0]
+	}
 
-	//Horizontal differencing encoding
-	if cfg.Predictor == 2 {
-		off := 0
+	switch sampleFormat(cfg.SampleFormat[0]) {
+	case uintSample:
 		switch cfg.BitsPerSample[0] {
+		case 1:
+			return scicolor.GrayU8Model{Min: 0, Max: 1}
 		case 8:
-			for y := 0; y < int(cfg.TileHeight); y++ {
-				v0 := d.buf[off]
-				for x := 0; x < int(cfg.TileWidth); x++ {
-					off++
-					v1 := d.buf[off] + v0
-					d.buf[off] = v1
-					v0 = v1
-				}
-				off++
-			}
+			return scicolor.GrayU8Model{Min: uint8(clamp(min, 0, 255)), Max: uint8(clamp(max, 0, 255))}
+		case 12:
+			return scicolor.GrayU16Model{Min: uint16(clamp(min, 0, 4095)), Max: uint16(clamp(max, 0, 4095))}
 		case 16:
-			for y := 0; y < int(cfg.TileHeight); y++ {
-				v0 := d.bo.Uint16(d.buf[off : off+2])
-				for x := 1; x < int(cfg.TileWidth); x++ {
-					off += 2
-					v1 := d.bo.Uint16(d.buf[off:off+2]) + v0
-					d.bo.PutUint16(d.buf[off:off+2], v1)
-					v0 = v1
-				}
-				off += 2
-			}
-		default:
-			return FormatError("Predictor not implemented for bit-sizes other than 8 or 16")
+			return scicolor.GrayU16Model{Min: uint16(clamp(min, 0, 65535)), Max: uint16(clamp(max, 0, 65535))}
+		}
+	case sintSample:
+		switch cfg.BitsPerSample[0] {
+		case 8:
+			return scicolor.GrayS8Model{Min: int8(clamp(min, -128, 127)), Max: int8(clamp(max, -128, 127))}
+		case 16:
+			return scicolor.GrayS16Model{Min: int16(clamp(min, -32768, 32767)), Max: int16(clamp(max, -32768, 32767))}
+		}
+	case ieeefpSample:
+		// Without the tags the range is infinite, and is taken from the
+		// decoded samples instead. 32-bit samples are widened, exactly, to
+		// 64-bit ones.
+		switch cfg.BitsPerSample[0] {
+		case 32, 64:
+			return GrayF64Model{Min: min, Max: max}
 		}
 	}
 
-	rMaxX := minInt(xmax, dst.Bounds().Max.X)
-	rMaxY := minInt(ymax, dst.Bounds().Max.Y)
+	return nil
+}
 
-	if cfg.SamplesPerPixel != 1 {
-		return FormatError("image data type not implemented")
-	}
+// clamp returns v limited to the range [min, max].
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
 
+// A target is the destination of decoded pixels. The pixels of a level
+// inside clip whose coordinates are multiples of step are written to img at
+// their coordinates divided by step plus delta. If rescale is not nil, the
+// samples are mapped by it on their way to img, which may then be any gray
+// image whatever the samples of the level.
+type target struct {
+	img     image.Image
+	clip    image.Rectangle
+	step    int
+	delta   image.Point
+	rescale func(v float64) float64
+}
+
+// keeps reports whether the pixel of the level at (x, y), which lies in a
+// block intersecting t.clip, is written to t. Blocks are walked from their
+// origin, so pixels above or left of the clip must be skipped.
+func (t target) keeps(x, y int) bool {
+	return x%t.step == 0 && y%t.step == 0 && x >= t.clip.Min.X && y >= t.clip.Min.Y
+}
+
+// decode decodes the raw data of an image.
+// It reads from d.buf and writes the strip or tile covering blk into t.
+// For chunky images with several samples per pixel only the given band is
+// decoded.
+func (d *decoder) decode(t target, level int, blk image.Rectangle, band int) error {
+	cfg := d.gt.Overviews[level]
+	xmin, ymin, xmax, ymax := blk.Min.X, blk.Min.Y, blk.Max.X, blk.Max.Y
+	clip, step, dx, dy := t.clip, t.step, t.delta.X, t.delta.Y
+
+	// Samples of a pixel are interleaved unless the planes are stored
+	// separately, in which case the tile only holds the requested band.
+	spp, sample := 1, 0
+	if cfg.PlanarConfig != 2 && cfg.SamplesPerPixel > 1 {
+		spp, sample = int(cfg.SamplesPerPixel), band
+	}
+	sampleBytes := int(cfg.BitsPerSample[0]) / 8
+	stride := spp * sampleBytes
+	boff := sample * sampleBytes
+
+	if cfg.BitsPerSample[0] == 1 && t.rescale == nil {
+		return d.decodeBilevel(t, cfg, blk, spp, sample)
+	}
+
+	//Horizontal differencing encoding: each sample is stored as the
+	//difference with the same sample of the previous pixel.
+	if cfg.Predictor == prHorizontal {
+		rowLen := int(cfg.TileWidth) * spp
+		rows := minInt(int(cfg.TileHeight), len(d.buf)/(rowLen*sampleBytes))
+		switch cfg.BitsPerSample[0] {
+		case 8:
+			for y := 0; y < rows; y++ {
+				row := d.buf[y*rowLen : (y+1)*rowLen]
+				for k := spp; k < rowLen; k++ {
+					row[k] += row[k-spp]
+				}
+			}
+		case 16:
+			for y := 0; y < rows; y++ {
+				row := d.buf[2*y*rowLen : 2*(y+1)*rowLen]
+				for k := spp; k < rowLen; k++ {
+					v := d.bo.Uint16(row[2*k:]) + d.bo.Uint16(row[2*(k-spp):])
+					d.bo.PutUint16(row[2*k:], v)
+				}
+			}
+		default:
+			return FormatError("Predictor not implemented for bit-sizes other than 8 or 16")
+		}
+	}
+	if cfg.Predictor == prFloatingPoint {
+		if cfg.BitsPerSample[0] != 32 && cfg.BitsPerSample[0] != 64 {
+			return UnsupportedError(fmt.Sprintf("floating point predictor for BitsPerSample of %d", cfg.BitsPerSample[0]))
+		}
+		rowLen := int(cfg.TileWidth) * spp * sampleBytes
+		for y := 0; (y+1)*rowLen <= len(d.buf) && y < int(cfg.TileHeight); y++ {
+			undoFloatPredictor(d.buf[y*rowLen:(y+1)*rowLen], spp, sampleBytes, d.bo)
+		}
+	}
+
+	// WhiteIsZero samples are inverted by complementing their bits, which
+	// maps the range of both unsigned and signed integers onto itself.
+	// Floating point samples, which have no such range, are left as stored.
+	if cfg.PhotometricInterpr == pWhiteIsZero && sampleFormat(cfg.SampleFormat[0]) != ieeefpSample {
+		for i := range d.buf {
+			d.buf[i] = ^d.buf[i]
+		}
+	}
+
+	if t.rescale != nil {
+		return d.decodeRescaled(t, cfg, blk, spp, sample)
+	}
+	if cfg.BitsPerSample[0] == 12 {
+		return d.decode12(t, cfg, blk, spp, sample)
+	}
+	if _, _, _, ok := rgbPix(t.img); ok {
+		return d.decodeRGB(t, cfg, blk, band)
+	}
+
+	rMaxX := minInt(xmax, clip.Max.X)
+	rMaxY := minInt(ymax, clip.Max.Y)
+
+	// d.buf holds this block only, so off starts afresh for each one.
+	// The padding columns of edge blocks, and any columns past the clip,
+	// are skipped at the end of each row. Rows below rMaxY, padding
+	// included, are never read, so they cannot shift the next block.
 	off := 0
-	switch img := dst.(type) {
+	xf := d.sampleTransform()
+	switch img := t.img.(type) {
 	case *scimage.GrayU8:
 		for y := ymin; y < rMaxY; y++ {
 			for x := xmin; x < rMaxX; x++ {
-				if off+1 > len(d.buf) {
+				if off+stride > len(d.buf) {
 					return errNoPixels
 				}
-				v := uint8(d.buf[off+0])
-				off++
-				img.SetGrayU8(x, y, scicolor.GrayU8{uint8(v), img.Min, img.Max})
-			}
-			if rMaxX == img.Bounds().Max.X {
-				off += xmax - img.Bounds().Max.X
+				v := uint8(d.buf[off+boff])
+				off += stride
+				if t.keeps(x, y) {
+					if xf != nil {
+						v = uint8(transformSample(xf, float64(v), 0, math.MaxUint8))
+					}
+					img.SetGrayU8(x/step+dx, y/step+dy, scicolor.GrayU8{uint8(v), img.Min, img.Max})
+				}
 			}
+			off += stride * (xmax - rMaxX)
 		}
 	case *scimage.GrayU16:
 		for y := ymin; y < rMaxY; y++ {
 			for x := xmin; x < rMaxX; x++ {
-				if off+2 > len(d.buf) {
+				if off+stride > len(d.buf) {
 					return errNoPixels
 				}
-				v := d.bo.Uint16(d.buf[off : off+2])
-				off += 2
-				img.SetGrayU16(x, y, scicolor.GrayU16{v, img.Min, img.Max})
-			}
-			if rMaxX == img.Bounds().Max.X {
-				off += 2 * (xmax - img.Bounds().Max.X)
+				v := d.bo.Uint16(d.buf[off+boff : off+boff+2])
+				off += stride
+				if t.keeps(x, y) {
+					if xf != nil {
+						v = uint16(transformSample(xf, float64(v), 0, math.MaxUint16))
+					}
+					img.SetGrayU16(x/step+dx, y/step+dy, scicolor.GrayU16{v, img.Min, img.Max})
+				}
 			}
+			off += stride * (xmax - rMaxX)
 		}
 	case *scimage.GrayS8:
 		for y := ymin; y < rMaxY; y++ {
 			for x := xmin; x < rMaxX; x++ {
-				if off+1 > len(d.buf) {
+				if off+stride > len(d.buf) {
 					return errNoPixels
 				}
-				v := int8(d.buf[off+0])
-				off++
-				img.SetGrayS8(x, y, scicolor.GrayS8{int8(v), img.Min, img.Max})
-			}
-			if rMaxX == img.Bounds().Max.X {
-				off += xmax - img.Bounds().Max.X
+				v := int8(d.buf[off+boff])
+				off += stride
+				if t.keeps(x, y) {
+					if xf != nil {
+						v = int8(transformSample(xf, float64(v), math.MinInt8, math.MaxInt8))
+					}
+					img.SetGrayS8(x/step+dx, y/step+dy, scicolor.GrayS8{int8(v), img.Min, img.Max})
+				}
 			}
+			off += stride * (xmax - rMaxX)
 		}
 	case *scimage.GrayS16:
 		for y := ymin; y < rMaxY; y++ {
 			for x := xmin; x < rMaxX; x++ {
-				if off+2 > len(d.buf) {
+				if off+stride > len(d.buf) {
+					return errNoPixels
+				}
+				v := int16(d.bo.Uint16(d.buf[off+boff : off+boff+2]))
+				off += stride
+				if t.keeps(x, y) {
+					if xf != nil {
+						v = int16(transformSample(xf, float64(v), math.MinInt16, math.MaxInt16))
+					}
+					img.SetGrayS16(x/step+dx, y/step+dy, scicolor.GrayS16{v, img.Min, img.Max})
+				}
+			}
+			off += stride * (xmax - rMaxX)
+		}
+	case *GrayF64Image:
+		nodata := d.opts != nil && d.opts.NoDataToNaN && d.gt.hasNoData
+		noData := d.gt.NoData
+		if sampleBytes == 4 {
+			noData = float64(float32(noData))
+		}
+		for y := ymin; y < rMaxY; y++ {
+			for x := xmin; x < rMaxX; x++ {
+				if off+stride > len(d.buf) {
 					return errNoPixels
 				}
-				v := int16(d.bo.Uint16(d.buf[off : off+2]))
-				off += 2
-				img.SetGrayS16(x, y, scicolor.GrayS16{v, img.Min, img.Max})
+				var v float64
+				if sampleBytes == 4 {
+					v = float64(math.Float32frombits(d.bo.Uint32(d.buf[off+boff : off+boff+4])))
+				} else {
+					v = math.Float64frombits(d.bo.Uint64(d.buf[off+boff : off+boff+8]))
+				}
+				if nodata && v == noData {
+					v = math.NaN()
+				}
+				off += stride
+				if t.keeps(x, y) {
+					if xf != nil {
+						v = xf(v)
+					}
+					img.SetGrayF64(x/step+dx, y/step+dy, GrayF64{v, img.Min, img.Max})
+				}
 			}
-			if rMaxX == img.Bounds().Max.X {
-				off += 2 * (xmax - img.Bounds().Max.X)
+			off += stride * (xmax - rMaxX)
+		}
+	case *image.Paletted:
+		if sampleBytes != 1 {
+			return UnsupportedError(fmt.Sprintf("paletted image with BitsPerSample of %d", cfg.BitsPerSample[0]))
+		}
+		for y := ymin; y < rMaxY; y++ {
+			for x := xmin; x < rMaxX; x++ {
+				if off+stride > len(d.buf) {
+					return errNoPixels
+				}
+				v := d.buf[off+boff]
+				off += stride
+				if t.keeps(x, y) {
+					img.SetColorIndex(x/step+dx, y/step+dy, v)
+				}
 			}
+			off += stride * (xmax - rMaxX)
 		}
 	default:
 		return FormatError("malformed header")
@@ -593,17 +1604,421 @@ func (d *decoder) decode(dst image.Image, level, xmin, ymin, xmax, ymax int) err
 	return nil
 }
 
-func decodeLevelSubImage(d decoder, level int, rect image.Rectangle) (img image.Image, err error) {
+// decodeBilevel decodes the 1-bit samples in d.buf, whose rows are padded
+// to whole bytes, into t as 0 for black and 1 for white.
+func (d *decoder) decodeBilevel(t target, cfg ImgDesc, blk image.Rectangle, spp, sample int) error {
+	img, ok := t.img.(*scimage.GrayU8)
+	if !ok {
+		return FormatError("bilevel image data type not implemented")
+	}
+	invert := cfg.PhotometricInterpr == pWhiteIsZero
+	rowBytes := (blk.Dx()*spp + 7) / 8
+	rMaxX := minInt(blk.Max.X, t.clip.Max.X)
+	rMaxY := minInt(blk.Max.Y, t.clip.Max.Y)
+	xf := d.sampleTransform()
+
+	for y := blk.Min.Y; y < rMaxY; y++ {
+		row := (y - blk.Min.Y) * rowBytes
+		for x := blk.Min.X; x < rMaxX; x++ {
+			bit := (x-blk.Min.X)*spp + sample
+			if row+bit/8 >= len(d.buf) {
+				return errNoPixels
+			}
+			v := d.buf[row+bit/8] >> (7 - uint(bit%8)) & 1
+			if invert {
+				v ^= 1
+			}
+			if t.keeps(x, y) {
+				if xf != nil {
+					v = uint8(transformSample(xf, float64(v), 0, math.MaxUint8))
+				}
+				img.SetGrayU8(x/t.step+t.delta.X, y/t.step+t.delta.Y, scicolor.GrayU8{v, img.Min, img.Max})
+			}
+		}
+	}
+
+	return nil
+}
+
+// decode12 decodes the 12-bit samples in d.buf, packed two in three bytes
+// most significant bits first and with rows padded to whole bytes, into t.
+func (d *decoder) decode12(t target, cfg ImgDesc, blk image.Rectangle, spp, sample int) error {
+	img, ok := t.img.(*scimage.GrayU16)
+	if !ok {
+		return FormatError("12-bit image data type not implemented")
+	}
+	if cfg.Predictor > prNone {
+		return UnsupportedError("predictor with BitsPerSample of 12")
+	}
+	rowBytes := (blk.Dx()*spp*12 + 7) / 8
+	rMaxX := minInt(blk.Max.X, t.clip.Max.X)
+	rMaxY := minInt(blk.Max.Y, t.clip.Max.Y)
+	xf := d.sampleTransform()
+
+	for y := blk.Min.Y; y < rMaxY; y++ {
+		row := (y - blk.Min.Y) * rowBytes
+		for x := blk.Min.X; x < rMaxX; x++ {
+			bit := ((x-blk.Min.X)*spp + sample) * 12
+			i := row + bit/8
+			if i+1 >= len(d.buf) {
+				return errNoPixels
+			}
+			v := uint16(d.buf[i])<<8 | uint16(d.buf[i+1])
+			if bit%8 == 0 {
+				v >>= 4
+			}
+			v &= 0xfff
+			if t.keeps(x, y) {
+				if xf != nil {
+					v = uint16(transformSample(xf, float64(v), 0, 4095))
+				}
+				img.SetGrayU16(x/t.step+t.delta.X, y/t.step+t.delta.Y, scicolor.GrayU16{v, img.Min, img.Max})
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeRescaled decodes the samples in d.buf, of any size and format, into
+// the gray image of t, mapped by t.rescale. The predictor must have been
+// undone.
+func (d *decoder) decodeRescaled(t target, cfg ImgDesc, blk image.Rectangle, spp, sample int) error {
+	set, err := sampleSetter(t.img)
+	if err != nil {
+		return err
+	}
+	cfg.Predictor = prNone
+	read, err := cfg.sampleReader(d.bo)
+	if err != nil {
+		return err
+	}
+	rowBytes := (blk.Dx()*spp*int(cfg.BitsPerSample[0]) + 7) / 8
+	row := make([]float64, blk.Dx()*spp)
+	rMaxX := minInt(blk.Max.X, t.clip.Max.X)
+	rMaxY := minInt(blk.Max.Y, t.clip.Max.Y)
+	xf := d.sampleTransform()
+
+	for y := blk.Min.Y; y < rMaxY; y++ {
+		start := (y - blk.Min.Y) * rowBytes
+		if start+rowBytes > len(d.buf) {
+			return errNoPixels
+		}
+		read(d.buf[start:start+rowBytes], row, spp)
+		for x := blk.Min.X; x < rMaxX; x++ {
+			if !t.keeps(x, y) {
+				continue
+			}
+			v := row[(x-blk.Min.X)*spp+sample]
+			if xf != nil {
+				v = xf(v)
+			}
+			set(x/t.step+t.delta.X, y/t.step+t.delta.Y, t.rescale(v))
+		}
+	}
+
+	return nil
+}
+
+// readTile reads the n bytes of tile found at offset in src and
+// decompresses them into d.buf.
+func (d *decoder) readTile(cfg ImgDesc, src io.ReaderAt, tile int, offset, n int64) (err error) {
+	switch cfg.Compression {
+
+	// According to the spec, Compression does not have a default value,
+	// but some tools interpret a missing Compression value as none so we do
+	// the same.
+	case cNone, 0:
+		// The predictor and the inversion of WhiteIsZero samples are
+		// undone in place, which must not alter the buffered file, so
+		// only tiles needing neither can be sliced.
+		if b, ok := src.(*buffer); ok && cfg.Predictor == prNone && cfg.PhotometricInterpr != pWhiteIsZero {
+			d.buf, err = b.Slice(int(offset), int(n))
+		} else {
+			d.buf = make([]byte, n)
+			_, err = src.ReadAt(d.buf, offset)
+		}
+	case cLZW:
+		r := lzw.NewReader(io.NewSectionReader(src, offset, n), lzw.MSB, 8)
+		d.buf, err = d.readDecompressed(r, cfg)
+		r.Close()
+	case cDeflate, cDeflateOld:
+		// Some producers write raw deflate streams, without the zlib
+		// wrapper the spec requires.
+		sr := io.NewSectionReader(src, offset, n)
+		var r io.ReadCloser
+		if isZlib(src, offset) {
+			r, err = zlib.NewReader(sr)
+		} else {
+			r = flate.NewReader(sr)
+		}
+		if err == nil {
+			d.buf, err = d.readDecompressed(r, cfg)
+			r.Close()
+		}
+		if err != nil && d.opts != nil && d.opts.RawDeflateFallback && int(n) == cfg.tileSize() {
+			log.Printf("tile %d: %v, reading it as uncompressed", tile, err)
+			d.buf = make([]byte, n)
+			_, err = src.ReadAt(d.buf, offset)
+		}
+	// Compression 2, CCITT modified Huffman, is not supported: its rows lack
+	// the EOL codes the Group 3 decoder of x/image requires, so it falls to
+	// the default case and may be provided with RegisterDecompressor.
+	case cG3, cG4:
+		order := ccitt.MSB
+		if cfg.FillOrder == 2 {
+			order = ccitt.LSB
+		}
+		sf := ccitt.Group3
+		if cfg.Compression == cG4 {
+			sf = ccitt.Group4
+		}
+		// Leave the bits following the photometric interpretation, so
+		// they are handled like uncompressed bilevel data.
+		inv := cfg.PhotometricInterpr == pWhiteIsZero
+		r := ccitt.NewReader(io.NewSectionReader(src, offset, n), order, sf,
+			int(cfg.TileWidth), cfg.blockRows(tile), &ccitt.Options{Invert: inv})
+		d.buf, err = d.readDecompressed(r, cfg)
+	case cLZMA:
+		var r io.Reader
+		r, err = xz.NewReader(io.NewSectionReader(src, offset, n))
+		if err == nil {
+			d.buf, err = d.readDecompressed(r, cfg)
+		}
+	case cPackBits:
+		d.buf, err = unpackBits(io.NewSectionReader(src, offset, n))
+	default:
+		if fn := decompressor(cfg.Compression); fn != nil {
+			r := fn(io.NewSectionReader(src, offset, n))
+			d.buf, err = d.readDecompressed(r, cfg)
+			r.Close()
+			break
+		}
+		err = UnsupportedError(fmt.Sprintf("compression value %d", cfg.Compression))
+		if name, ok := compressionNames[cfg.Compression]; ok {
+			err = UnsupportedError(fmt.Sprintf("%s compression (%d)", name, cfg.Compression))
+		}
+	}
+	if err == nil && cfg.Compression != cNone && cfg.Compression != 0 {
+		err = d.checkTileSize(cfg, tile)
+	}
+	return err
+}
+
+// readDecompressed reads the tile of cfg decompressed by r. With
+// Options.StrictTileSize, reading stops with an error as soon as the tile
+// grows past what checkTileSize tolerates, so a corrupt or malicious tile
+// cannot take much more memory than a tile does.
+func (d *decoder) readDecompressed(r io.Reader, cfg ImgDesc) ([]byte, error) {
+	size := cfg.tileSize()
+	if d.opts == nil || !d.opts.StrictTileSize || cfg.TileHeight == 0 {
+		return readAll(r, size)
+	}
+	max := size + size/int(cfg.TileHeight)
+	buf, err := readAll(io.LimitReader(r, int64(max)), size)
+	if err == nil && len(buf) == max {
+		return nil, FormatError(fmt.Sprintf("decompressed to more than %d bytes, expected %d", max-1, size))
+	}
+	return buf, err
+}
+
+// checkTileSize reports decompressed tiles in d.buf longer than cfg
+// allows. An excess of less than a row is tolerated, as some encoders pad
+// their output.
+func (d *decoder) checkTileSize(cfg ImgDesc, tile int) error {
+	size := cfg.tileSize()
+	if cfg.TileHeight == 0 || len(d.buf)-size < size/int(cfg.TileHeight) {
+		return nil
+	}
+	msg := fmt.Sprintf("decompressed to %d bytes, expected %d", len(d.buf), size)
+	if d.opts != nil && d.opts.StrictTileSize {
+		return FormatError(msg)
+	}
+	log.Printf("tile %d: %s", tile, msg)
+	return nil
+}
+
+// decodeLevelSubImage decodes the part of level intersecting rect. With a
+// step greater than one only every step-th pixel in each direction is kept,
+// producing an image whose bounds are those of the intersection divided by
+// step. A negative band decodes the image as described by its photometric
+// interpretation, otherwise only that sample of each pixel is decoded into
+// a gray image.
+func decodeLevelSubImage(d decoder, level int, rect image.Rectangle, step, band int) (img image.Image, err error) {
 	cfg := d.gt.Overviews[level]
 
-	blockPadding := false
-	blocksAcross := 1
-	blocksDown := 1
+	model := d.colorModel(level)
+	sample := 0
+	if band >= 0 {
+		if band >= int(cfg.SamplesPerPixel) && band != 0 {
+			return nil, fmt.Errorf("band %d not in this geotiff", band)
+		}
+		model = d.grayModel(cfg)
+		if d.opts != nil && d.opts.ForceColorModel != nil {
+			model = d.opts.ForceColorModel
+		}
+		sample = band
+	}
 
 	if cfg.ImageWidth == 0 || cfg.ImageHeight == 0 {
 		return nil, FormatError("unexpected image dimensions")
 	}
 
+	tileAligned := d.opts != nil && d.opts.TileAligned && cfg.TileWidth != 0 && cfg.TileHeight != 0
+	align := func(r image.Rectangle) image.Rectangle {
+		tw, th := int(cfg.TileWidth), int(cfg.TileHeight)
+		return image.Rect(r.Min.X/tw*tw, r.Min.Y/th*th, ceilDiv(r.Max.X, tw)*tw, ceilDiv(r.Max.Y, th)*th)
+	}
+
+	imgRect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)).Intersect(rect)
+	if imgRect.Empty() {
+		return nil, fmt.Errorf("the rectangle provided does not intersect the image")
+	}
+	if step < 1 {
+		return nil, fmt.Errorf("decimation step %d must be positive", step)
+	}
+	allocRect := imgRect
+	if d.opts != nil && d.opts.FullLevel {
+		allocRect = image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
+	}
+	if tileAligned {
+		allocRect = align(allocRect)
+		imgRect = align(imgRect).Intersect(image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)))
+	}
+	outRect := image.Rect(ceilDiv(allocRect.Min.X, step), ceilDiv(allocRect.Min.Y, step),
+		ceilDiv(allocRect.Max.X, step), ceilDiv(allocRect.Max.Y, step))
+	if n, max := int64(outRect.Dx())*int64(outRect.Dy()), d.opts.maxPixels(); n > max {
+		return nil, UnsupportedError(fmt.Sprintf("image of %d pixels exceeds the limit of %d", n, max))
+	}
+
+	img, err = newImage(model, outRect)
+	if err != nil {
+		return nil, err
+	}
+	if tileAligned && d.opts.PadValue != 0 {
+		fillImage(img, d.opts.PadValue)
+	}
+
+	if isRGBModel(model) {
+		err = d.decodeRGBTiles(level, target{img: img, clip: imgRect, step: step})
+	} else {
+		err = d.decodeTiles(level, target{img: img, clip: imgRect, step: step}, sample)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := img.(*GrayF64Image); ok && (math.IsInf(f.Min, 0) || math.IsInf(f.Max, 0)) {
+		min, max := sampleRange(img)
+		setRange(img, min, max)
+	}
+
+	if d.opts != nil && d.opts.AutoRange && !d.hasDisplayRange() && !isRGBModel(model) {
+		min, max, err := d.levelRange(level, band)
+		if err != nil {
+			return nil, err
+		}
+		setRange(img, min, max)
+	}
+	return
+}
+
+// eachTile decodes the whole image at level one tile at a time, in
+// row-major order, calling fn with each decoded tile, the number of tiles
+// decoded so far and their total.
+func (d decoder) eachTile(level int, fn func(tile image.Image, done, total int) error) error {
+	rects, err := d.tileRects(level)
+	if err != nil {
+		return err
+	}
+	d = d.perTile()
+	for k, rect := range rects {
+		tile, err := decodeLevelSubImage(d, level, rect, 1, -1)
+		if err != nil {
+			return err
+		}
+		if err := fn(tile, k+1, len(rects)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// perTile returns a copy of d for decoding single tiles, ignoring the
+// options that apply to whole images, such as AutoRange.
+func (d decoder) perTile() decoder {
+	if d.opts != nil {
+		opts := *d.opts
+		opts.FullLevel, opts.AutoRange, opts.Progress, opts.TileAligned = false, false, nil, false
+		d.opts = &opts
+	}
+	return d
+}
+
+// tileRects returns the bounds of the tiles of level in row-major order,
+// clipped to the image.
+func (d decoder) tileRects(level int) ([]image.Rectangle, error) {
+	cfg := d.gt.Overviews[level]
+	if cfg.ImageWidth == 0 || cfg.ImageHeight == 0 || cfg.TileWidth == 0 || cfg.TileHeight == 0 {
+		return nil, FormatError("unexpected image dimensions")
+	}
+	tw, th := int(cfg.TileWidth), int(cfg.TileHeight)
+	bounds := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
+	var rects []image.Rectangle
+	for y := 0; y < bounds.Max.Y; y += th {
+		for x := 0; x < bounds.Max.X; x += tw {
+			rects = append(rects, image.Rect(x, y, x+tw, y+th).Intersect(bounds))
+		}
+	}
+	return rects, nil
+}
+
+// newImage allocates an image with bounds r for pixels of the given model.
+func newImage(model color.Model, r image.Rectangle) (image.Image, error) {
+	switch model {
+	case color.RGBAModel:
+		return image.NewRGBA(r), nil
+	case color.NRGBAModel:
+		return image.NewNRGBA(r), nil
+	}
+	switch v := model.(type) {
+	case scicolor.GrayU8Model:
+		return scimage.NewGrayU8(r, v.Min, v.Max), nil
+	case scicolor.GrayU16Model:
+		return scimage.NewGrayU16(r, v.Min, v.Max), nil
+	case scicolor.GrayS8Model:
+		return scimage.NewGrayS8(r, v.Min, v.Max), nil
+	case scicolor.GrayS16Model:
+		return scimage.NewGrayS16(r, v.Min, v.Max), nil
+	case GrayF64Model:
+		return NewGrayF64Image(r, v.Min, v.Max), nil
+	case color.Palette:
+		return image.NewPaletted(r, v), nil
+	}
+	return nil, FormatError("image data type not implemented")
+}
+
+// tileIndex returns the index in the TileOffsets of a plane of the tile at
+// column i and row j of a grid of across by down tiles.
+func (d *decoder) tileIndex(i, j, across, down int) (int, error) {
+	if d.opts == nil || d.opts.TileIndex == nil {
+		return j*across + i, nil
+	}
+	k := d.opts.TileIndex(i, j, across, down)
+	if k < 0 || k >= across*down {
+		return 0, fmt.Errorf("tile index %d of tile (%d, %d) outside the %dx%d grid", k, i, j, across, down)
+	}
+	return k, nil
+}
+
+// decodeTiles reads and decodes the tiles of level intersecting t.clip into
+// t. For images with several samples per pixel only sample is decoded.
+func (d *decoder) decodeTiles(level int, t target, sample int) (err error) {
+	cfg := d.gt.Overviews[level]
+
+	blockPadding := false
+	blocksAcross := 1
+	blocksDown := 1
+
 	if cfg.TileWidth != 0 {
 		blockPadding = true
 		blocksAcross = int((cfg.ImageWidth + cfg.TileWidth - 1) / cfg.TileWidth)
@@ -612,95 +2027,611 @@ func decodeLevelSubImage(d decoder, level int, rect image.Rectangle) (img image.
 		}
 	}
 
+	// Separate planes store the tiles of each band one after the other.
+	planeOffset := 0
+	planes := 1
+	if cfg.PlanarConfig == 2 && cfg.SamplesPerPixel > 1 {
+		planeOffset = sample * blocksAcross * blocksDown
+		planes = int(cfg.SamplesPerPixel)
+	}
+
 	// Check if we have the right number of strips/tiles, offsets and counts.
-	if n := blocksAcross * blocksDown; len(cfg.TileOffsets) < n || len(cfg.TileByteCounts) < n {
-		return nil, FormatError("inconsistent header")
+	if n := blocksAcross * blocksDown * planes; len(cfg.TileOffsets) < n || len(cfg.TileByteCounts) < n {
+		return FormatError(fmt.Sprintf("inconsistent header: %d tiles but %d TileOffsets and %d TileByteCounts",
+			n, len(cfg.TileOffsets), len(cfg.TileByteCounts)))
 	}
 
 	switch cfg.BitsPerSample[0] {
 	case 0:
-		return nil, FormatError("BitsPerSample must not be 0")
-	case 8, 16:
+		return FormatError("BitsPerSample must not be 0")
+	case 1, 8, 12, 16, 32, 64:
 		// Nothing to do, these are accepted by this implementation.
 	default:
-		return nil, UnsupportedError(fmt.Sprintf("BitsPerSample of %v", cfg.BitsPerSample))
+		return UnsupportedError(fmt.Sprintf("BitsPerSample of %v", cfg.BitsPerSample))
 	}
 
-	imgRect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)).Intersect(rect)
-	if imgRect.Empty() {
-		return nil, fmt.Errorf("the rectangle provided does not intersect the image")
+	// Tiles are visited in row-major order, the order in which they are
+	// usually stored. Tiles on the right and bottom edges are padded to the
+	// full tile size, decode skips the padding of every row while the rows
+	// of padding at the bottom are simply left unread.
+	clip := t.clip
+	var tiles []image.Point
+	for j := clip.Min.Y / int(cfg.TileHeight); j <= (clip.Max.Y-1)/int(cfg.TileHeight); j++ {
+		for i := clip.Min.X / int(cfg.TileWidth); i <= (clip.Max.X-1)/int(cfg.TileWidth); i++ {
+			tiles = append(tiles, image.Pt(i, j))
+		}
 	}
 
-	switch v := d.colorModel(level).(type) {
-	case scicolor.GrayU8Model:
-		img = scimage.NewGrayU8(imgRect, v.Min, v.Max)
-	case scicolor.GrayU16Model:
-		img = scimage.NewGrayU16(imgRect, v.Min, v.Max)
-	case scicolor.GrayS8Model:
-		img = scimage.NewGrayS8(imgRect, v.Min, v.Max)
-	case scicolor.GrayS16Model:
-		img = scimage.NewGrayS16(imgRect, v.Min, v.Max)
-	default:
-		return nil, FormatError("image data type not implemented")
+	// A buffer is not safe for concurrent reads, so prefetching is only
+	// possible on a real io.ReaderAt.
+	var pf *prefetcher
+	if _, buffered := d.ra.(*buffer); d.opts != nil && d.opts.Prefetch > 0 && !buffered {
+		ranges := make([][2]int64, len(tiles))
+		for k, pt := range tiles {
+			idx, err := d.tileIndex(pt.X, pt.Y, blocksAcross, blocksDown)
+			if err != nil {
+				return err
+			}
+			offset, n, err := cfg.tileLocation(planeOffset + idx)
+			if err != nil {
+				return err
+			}
+			ranges[k] = [2]int64{offset, n}
+		}
+		pf = newPrefetcher(d.ra, ranges, d.opts.Prefetch)
+		defer pf.close()
 	}
 
-	for i := imgRect.Bounds().Min.X / int(cfg.TileWidth); i <= imgRect.Bounds().Max.X/int(cfg.TileWidth); i++ {
+	for k, pt := range tiles {
+		i, j := pt.X, pt.Y
 		blkW := int(cfg.TileWidth)
 		if !blockPadding && i == blocksAcross-1 && cfg.ImageWidth%cfg.TileWidth != 0 {
 			blkW = int(cfg.ImageWidth % cfg.TileWidth)
 		}
-		for j := imgRect.Bounds().Min.Y / int(cfg.TileWidth); j <= imgRect.Bounds().Max.Y/int(cfg.TileWidth); j++ {
-			blkH := int(cfg.TileHeight)
-			if !blockPadding && j == blocksDown-1 && cfg.ImageHeight%cfg.TileHeight != 0 {
-				blkH = int(cfg.ImageHeight % cfg.TileHeight)
-			}
-			offset := int64(cfg.TileOffsets[j*blocksAcross+i])
-			n := int64(cfg.TileByteCounts[j*blocksAcross+i])
-			switch cfg.Compression {
-
-			// According to the spec, Compression does not have a default value,
-			// but some tools interpret a missing Compression value as none so we do
-			// the same.
-			case cNone, 0:
-				if b, ok := d.ra.(*buffer); ok {
-					d.buf, err = b.Slice(int(offset), int(n))
-				} else {
-					d.buf = make([]byte, n)
-					_, err = d.ra.ReadAt(d.buf, offset)
-				}
-			case cLZW:
-				r := lzw.NewReader(io.NewSectionReader(d.ra, offset, n), lzw.MSB, 8)
-				d.buf, err = ioutil.ReadAll(r)
-				r.Close()
-			case cDeflate, cDeflateOld:
-				var r io.ReadCloser
-				r, err = zlib.NewReader(io.NewSectionReader(d.ra, offset, n))
-				if err != nil {
-					return nil, err
-				}
-				d.buf, err = ioutil.ReadAll(r)
-				r.Close()
-			case cPackBits:
-				d.buf, err = unpackBits(io.NewSectionReader(d.ra, offset, n))
-			default:
-				err = UnsupportedError(fmt.Sprintf("compression value %d", cfg.Compression))
-			}
-			if err != nil {
-				return nil, err
+		blkH := int(cfg.TileHeight)
+		if !blockPadding && j == blocksDown-1 && cfg.ImageHeight%cfg.TileHeight != 0 {
+			blkH = int(cfg.ImageHeight % cfg.TileHeight)
+		}
+
+		idx, err := d.tileIndex(i, j, blocksAcross, blocksDown)
+		if err != nil {
+			return err
+		}
+		tile := planeOffset + idx
+		var src io.ReaderAt = d.ra
+		offset, n, err := cfg.tileLocation(tile)
+		if err != nil {
+			return err
+		}
+		if pf != nil {
+			var raw []byte
+			if raw, err = pf.get(k); err != nil {
+				return fmt.Errorf("tile %d: %w", tile, err)
 			}
+			src, offset = bytes.NewReader(raw), 0
+		}
+		if err = d.loadTile(level, cfg, src, tile, offset, n); err != nil {
+			return fmt.Errorf("tile %d: %w", tile, err)
+		}
+		if d.costs != nil {
+			*d.costs = append(*d.costs, TileCost{Tile: tile, CompressedBytes: n, DecompressedBytes: len(d.buf)})
+		}
 
-			xmin := i * int(cfg.TileWidth)
-			ymin := j * int(cfg.TileHeight)
-			xmax := xmin + blkW
-			ymax := ymin + blkH
+		xmin := i * int(cfg.TileWidth)
+		ymin := j * int(cfg.TileHeight)
+		blk := image.Rect(xmin, ymin, xmin+blkW, ymin+blkH)
 
-			err = d.decode(img, level, xmin, ymin, xmax, ymax)
-			if err != nil {
-				return nil, err
-			}
+		err = d.decode(t, level, blk, sample)
+		if err != nil {
+			return fmt.Errorf("tile %d: %w", tile, err)
+		}
+		if d.opts != nil && d.opts.Progress != nil {
+			d.opts.Progress(k+1, len(tiles))
 		}
 	}
-	return
+
+	return nil
+}
+
+// DecodeInto decodes the part of the image at level that intersects
+// srcRect directly into dst, placing srcRect.Min at dstOrigin, which allows
+// building mosaics from several files without intermediate images. dst
+// must be of the type the level decodes to, such as *scimage.GrayU16 for
+// unsigned 16-bit data. Pixels falling outside dst are discarded.
+func DecodeInto(r io.ReaderAt, level int, srcRect image.Rectangle, dst image.Image, dstOrigin image.Point) error {
+	return decodeInto(r, level, srcRect, dst, dstOrigin, false)
+}
+
+// DecodeIntoRescaled is DecodeInto in a mode where dst may be any gray
+// image and sample values are linearly mapped from the range of the level,
+// as given by its SMinSampleValue and SMaxSampleValue tags or its sample
+// type, to the Min and Max range of dst. Values outside the range are
+// clamped. The samples are mapped as each tile is decoded, without an
+// intermediate image. Floating point levels without the tags take the
+// range of all their samples, which are read once more beforehand.
+func DecodeIntoRescaled(r io.ReaderAt, level int, srcRect image.Rectangle, dst image.Image, dstOrigin image.Point) error {
+	return decodeInto(r, level, srcRect, dst, dstOrigin, true)
+}
+
+// decodeInto implements DecodeInto, mapping the samples to the range of
+// dst if rescale is set.
+func decodeInto(r io.ReaderAt, level int, srcRect image.Rectangle, dst image.Image, dstOrigin image.Point, rescale bool) error {
+	d, err := newDecoderAt(r)
+	if err != nil {
+		return err
+	}
+	err = d.readIFD()
+	if err != nil {
+		return err
+	}
+	if err = d.checkLevel(level); err != nil {
+		return err
+	}
+
+	cfg := d.gt.Overviews[level]
+	imgRect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)).Intersect(srcRect)
+	if imgRect.Empty() {
+		return fmt.Errorf("the rectangle provided does not intersect the image")
+	}
+	t := target{img: dst, clip: imgRect, step: 1, delta: dstOrigin.Sub(srcRect.Min)}
+	if !rescale {
+		if !modelMatches(d.colorModel(level), dst) {
+			return fmt.Errorf("cannot decode level %d into a %T", level, dst)
+		}
+		return d.decodeTiles(level, t, 0)
+	}
+
+	srcMin, srcMax, ok := modelRange(d.colorModel(level))
+	if !ok {
+		return fmt.Errorf("cannot rescale the samples of level %d", level)
+	}
+	if math.IsInf(srcMin, 0) || math.IsInf(srcMax, 0) {
+		if srcMin, srcMax, err = d.levelRange(level, -1); err != nil {
+			return err
+		}
+	}
+	if srcMax <= srcMin {
+		return fmt.Errorf("invalid source range [%v, %v]", srcMin, srcMax)
+	}
+	dstMin, dstMax := imageRange(dst)
+	scale := (dstMax - dstMin) / (srcMax - srcMin)
+	t.rescale = func(v float64) float64 {
+		return clamp(dstMin+(v-srcMin)*scale, dstMin, dstMax)
+	}
+	return d.decodeTiles(level, t, 0)
+}
+
+// modelMatches tells whether img is the image type decode produces for
+// the color model m.
+func modelMatches(m color.Model, img image.Image) bool {
+	ok := false
+	switch img.(type) {
+	case *scimage.GrayU8:
+		_, ok = m.(scicolor.GrayU8Model)
+	case *scimage.GrayU16:
+		_, ok = m.(scicolor.GrayU16Model)
+	case *scimage.GrayS8:
+		_, ok = m.(scicolor.GrayS8Model)
+	case *scimage.GrayS16:
+		_, ok = m.(scicolor.GrayS16Model)
+	case *GrayF64Image:
+		_, ok = m.(GrayF64Model)
+	case *image.Paletted:
+		_, ok = m.(color.Palette)
+	}
+	return ok
+}
+
+// A Reader decodes the levels of a COG. The IFDs are parsed once, when the
+// Reader is created, so a Reader is cheaper than the Decode functions when
+// several windows of the same file are needed.
+//
+// Each decode works on its own copy of the decoding state, so a Reader may
+// be shared by goroutines decoding concurrently, as long as the source
+// passed to NewReader is an io.ReaderAt safe for concurrent use, such as an
+// *os.File. Other sources are buffered, and their Reader must then be used
+// from one goroutine at a time.
+type Reader struct {
+	d     decoder
+	pages []int
+	ghost map[string]string
+	// geo and geoErr hold the result of parsing the GeoKeys, which only
+	// fails the calls that need them.
+	geo    GeoData
+	geoErr error
+}
+
+// NewReader parses the header and IFDs of the COG in r. A nil opts uses
+// the default Options.
+func NewReader(r io.Reader, opts *Options) (*Reader, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	return openReader(d, opts)
+}
+
+// openReader reads the IFDs of the file behind d and returns a Reader for
+// it.
+func openReader(d decoder, opts *Options) (*Reader, error) {
+	// Readers have options, defaults included, unlike the package-level
+	// functions.
+	if opts == nil {
+		opts = &Options{}
+	}
+	d.opts = opts
+	// The header is read in one go, buffered sources excepted as they
+	// already hold what they have read.
+	src := d.ra
+	if _, buffered := src.(*buffer); !buffered {
+		if n := headerBytes(opts); n > 0 {
+			d.ra = newHeaderReaderAt(src, n)
+		}
+	}
+	err := d.readIFD()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = d.checkForcedModel(); err != nil {
+		return nil, err
+	}
+
+	rd := &Reader{d: d}
+	if rd.ghost, err = d.readGhostArea(); err != nil {
+		return nil, err
+	}
+	rd.d.ra = src
+	for level, cfg := range d.gt.Overviews {
+		if cfg.NewSubfileType&(sfReducedImage|sfMask) == 0 {
+			rd.pages = append(rd.pages, level)
+		}
+	}
+	rd.geo, rd.geoErr = d.gt.geoData()
+	if opts != nil && opts.CheckByteOrder {
+		if _, err := rd.ByteOrderSuspect(0); err != nil {
+			log.Printf("checking the byte order: %v", err)
+		}
+	}
+
+	return rd, nil
+}
+
+// StructuralMetadata returns the key-value hints written by GDAL right after
+// the header of a COG, such as LAYOUT=IFDS_BEFORE_DATA or BLOCK_ORDER. It
+// returns nil if the file has none, which hints at it not being a COG
+// produced by GDAL.
+func (r *Reader) StructuralMetadata() map[string]string {
+	return r.ghost
+}
+
+// Pages returns the number of full resolution images in the file. It is
+// one for a COG, whose other IFDs are overviews or masks, and may be more
+// for multi-page TIFFs.
+func (r *Reader) Pages() int {
+	return len(r.pages)
+}
+
+// PageName returns the PageName tag of page, or an empty string if the page
+// does not exist or has none.
+func (r *Reader) PageName(page int) string {
+	if page < 0 || page >= len(r.pages) {
+		return ""
+	}
+	return r.d.gt.Overviews[r.pages[page]].PageName
+}
+
+// DocumentName returns the DocumentName tag of page, the name of the
+// document it was scanned from, or an empty string if the page does not
+// exist or has none.
+func (r *Reader) DocumentName(page int) string {
+	if page < 0 || page >= len(r.pages) {
+		return ""
+	}
+	return r.d.gt.Overviews[r.pages[page]].DocumentName
+}
+
+// DecodePage decodes the part of the full resolution image of page that
+// intersects rect.
+func (r *Reader) DecodePage(page int, rect image.Rectangle) (image.Image, error) {
+	if page < 0 || page >= len(r.pages) {
+		return nil, fmt.Errorf("page %d not in this geotiff", page)
+	}
+	return decodeLevelSubImage(r.d, r.pages[page], rect, 1, -1)
+}
+
+// checkLevel returns an error if level is not one of the parsed IFDs.
+func (d *decoder) checkLevel(level int) error {
+	if level < 0 || level >= len(d.gt.Overviews) {
+		return fmt.Errorf("level %d not in this geotiff", level)
+	}
+	return nil
+}
+
+// DecodeLevelSubImage decodes the part of the image at level that
+// intersects rect. The returned image is addressed in the pixel coordinates
+// of the level, so its bounds are that intersection, unless
+// Options.FullLevel is set.
+func (r *Reader) DecodeLevelSubImage(level int, rect image.Rectangle) (image.Image, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	return decodeLevelSubImage(r.d, level, rect, 1, -1)
+}
+
+// DecodeLevelSubImageDecimated decodes the part of the image at level that
+// intersects rect keeping only every step-th pixel in each direction. It is
+// meant for quick previews of levels lacking a suitable overview: the tiles
+// are still read in full but the returned image is step times smaller, its
+// bounds being those of the intersection divided by step.
+func (r *Reader) DecodeLevelSubImageDecimated(level int, rect image.Rectangle, step int) (image.Image, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	return decodeLevelSubImage(r.d, level, rect, step, -1)
+}
+
+// DecodeBand decodes a single sample plane, or band, of the part of the
+// image at level that intersects rect into a gray image. For images with
+// separate planes only the tiles of that band are read.
+func (r *Reader) DecodeBand(level, band int, rect image.Rectangle) (image.Image, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	return decodeLevelSubImage(r.d, level, rect, 1, band)
+}
+
+// Geotransform returns the geotransform of the image at level. Overviews
+// without georeferencing of their own share that of the full resolution
+// image, scaled by their decimation factor. As with GDAL, the geotransform
+// always maps pixel corners: the tiepoints of PixelIsPoint rasters, which
+// refer to the centre of a pixel, are shifted by half a pixel.
+func (r *Reader) Geotransform(level int) (Geotransform, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return Geotransform{}, err
+	}
+	if g := r.d.gt.Overviews[level].geo; g != nil && g.hasGeoTrans {
+		return r.cornerGeotransform(level, g.GeoTrans), nil
+	}
+	if !r.d.gt.hasGeoTrans {
+		return Geotransform{}, FormatError("no ModelTransformation or ModelTiepoint and ModelPixelScale tags")
+	}
+	full, ovr := r.d.gt.Overviews[0], r.d.gt.Overviews[level]
+	xScale := float64(full.ImageWidth) / float64(ovr.ImageWidth)
+	yScale := float64(full.ImageHeight) / float64(ovr.ImageHeight)
+
+	return r.cornerGeotransform(0, r.d.gt.GeoTrans).scale(xScale, yScale), nil
+}
+
+// cornerGeotransform returns gt, the geotransform read for level, shifted
+// to map pixel corners if the raster type of level is PixelIsPoint.
+func (r *Reader) cornerGeotransform(level int, gt Geotransform) Geotransform {
+	if geo, err := r.GeoData(level); err == nil && geo.RasterType == PixelIsPoint {
+		return gt.pixelIsPoint()
+	}
+	return gt
+}
+
+// DecodeLevelSubImageGeo is like DecodeLevelSubImage but also returns the
+// extent of the decoded image in the CRS of the file, as [minX, minY, maxX,
+// maxY]. The extent covers the whole of the outer pixels and, for rotated
+// images, is the bounding box of the four corners.
+func (r *Reader) DecodeLevelSubImageGeo(level int, rect image.Rectangle) (image.Image, [4]float64, error) {
+	gt, err := r.Geotransform(level)
+	if err != nil {
+		return nil, [4]float64{}, err
+	}
+	img, err := decodeLevelSubImage(r.d, level, rect, 1, -1)
+	if err != nil {
+		return nil, [4]float64{}, err
+	}
+
+	b := img.Bounds()
+	ext := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range []image.Point{b.Min, {b.Max.X, b.Min.Y}, {b.Min.X, b.Max.Y}, b.Max} {
+		x, y := gt.Forward(float64(p.X), float64(p.Y))
+		ext[0], ext[1] = math.Min(ext[0], x), math.Min(ext[1], y)
+		ext[2], ext[3] = math.Max(ext[2], x), math.Max(ext[3], y)
+	}
+	return img, ext, nil
+}
+
+// ValueAt returns the sample of the first band of level at the world
+// coordinates (x, y), reading only the tile containing it.
+func (r *Reader) ValueAt(level int, x, y float64) (float64, error) {
+	gt, err := r.Geotransform(level)
+	if err != nil {
+		return 0, err
+	}
+	px, py, err := gt.Inverse(x, y)
+	if err != nil {
+		return 0, err
+	}
+	pt := image.Pt(int(math.Floor(px)), int(math.Floor(py)))
+	cfg := r.d.gt.Overviews[level]
+	if !pt.In(image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))) {
+		return 0, fmt.Errorf("point (%v, %v) outside level %d", x, y, level)
+	}
+
+	img, err := decodeLevelSubImage(r.d.perTile(), level, image.Rectangle{pt, pt.Add(image.Pt(1, 1))}, 1, 0)
+	if err != nil {
+		return 0, err
+	}
+	at, err := sampleAt(img)
+	if err != nil {
+		return 0, err
+	}
+	return at(pt.X, pt.Y), nil
+}
+
+// GeoData returns the parsed GeoKeys that apply to level. The GeoKeys are
+// usually stored once per file, with the full resolution image, in which
+// case all levels share them.
+func (r *Reader) GeoData(level int) (GeoData, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return GeoData{}, err
+	}
+	if g := r.d.gt.Overviews[level].geo; g != nil && g.kEntries != nil {
+		return g.geoData()
+	}
+	return r.geo, r.geoErr
+}
+
+// WKT returns the coordinate reference system of level as WKT.
+func (r *Reader) WKT(level int) (string, error) {
+	geo, err := r.GeoData(level)
+	if err != nil {
+		return "", err
+	}
+	return geo.WKT()
+}
+
+// Proj4 returns the coordinate reference system of level as a Proj4 string.
+func (r *Reader) Proj4(level int) (string, error) {
+	geo, err := r.GeoData(level)
+	if err != nil {
+		return "", err
+	}
+	return geo.Proj4()
+}
+
+// Metadata returns the descriptive tags of the full resolution image. If
+// any of them is malformed it is left empty and an error is returned along
+// with the others.
+func (r *Reader) Metadata() (Metadata, error) {
+	return r.d.gt.Metadata, r.d.gt.metadataErr
+}
+
+// LevelInfo summarises the structure of a level.
+type LevelInfo struct {
+	Compression     uint16
+	Predictor       uint16
+	TileWidth       uint32
+	TileHeight      uint32
+	BitsPerSample   uint16 // Of the first sample.
+	SampleFormat    uint16 // Of the first sample.
+	SamplesPerPixel uint16
+	Photometric     uint16
+}
+
+// LevelInfo returns the structure of level, or a zero LevelInfo if the
+// level does not exist.
+func (r *Reader) LevelInfo(level int) LevelInfo {
+	if r.d.checkLevel(level) != nil {
+		return LevelInfo{}
+	}
+	cfg := r.d.gt.Overviews[level]
+	info := LevelInfo{
+		Compression:     cfg.Compression,
+		Predictor:       cfg.Predictor,
+		TileWidth:       cfg.TileWidth,
+		TileHeight:      cfg.TileHeight,
+		SamplesPerPixel: cfg.SamplesPerPixel,
+		Photometric:     cfg.PhotometricInterpr,
+	}
+	if len(cfg.BitsPerSample) > 0 {
+		info.BitsPerSample = cfg.BitsPerSample[0]
+	}
+	if len(cfg.SampleFormat) > 0 {
+		info.SampleFormat = cfg.SampleFormat[0]
+	}
+	return info
+}
+
+// IsDisplayReady reports whether level holds unsigned 8-bit samples meant
+// for display as they are: a single BlackIsZero band or three RGB ones,
+// over the full 0-255 range. Such levels, often the visual overviews of a
+// COG, need no stretching before rendering.
+func (r *Reader) IsDisplayReady(level int) bool {
+	if r.d.checkLevel(level) != nil {
+		return false
+	}
+	cfg := r.d.gt.Overviews[level]
+	switch {
+	case cfg.SamplesPerPixel == 1 && cfg.PhotometricInterpr == pBlackIsZero:
+	case cfg.SamplesPerPixel == 3 && cfg.PhotometricInterpr == pRGB:
+	default:
+		return false
+	}
+	for _, b := range cfg.BitsPerSample {
+		if b != 8 {
+			return false
+		}
+	}
+	for _, f := range cfg.SampleFormat {
+		if sampleFormat(f) != uintSample {
+			return false
+		}
+	}
+	for _, v := range cfg.SMinSampleValue {
+		if v != 0 {
+			return false
+		}
+	}
+	for _, v := range cfg.SMaxSampleValue {
+		if v != 255 {
+			return false
+		}
+	}
+	return true
+}
+
+// NumLevels returns the number of IFDs in the file, the full resolution
+// image, its overviews and any masks, which are all levels to the Decode
+// methods.
+func (r *Reader) NumLevels() int {
+	return len(r.d.gt.Overviews)
+}
+
+// LevelSize returns the width and height in pixels of the image at level.
+// It only depends on the IFD of the level, whatever its block layout.
+func (r *Reader) LevelSize(level int) (image.Point, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return image.Point{}, err
+	}
+	cfg := r.d.gt.Overviews[level]
+	return image.Pt(int(cfg.ImageWidth), int(cfg.ImageHeight)), nil
+}
+
+// LevelUncompressedBytes returns the memory taken by the image level
+// decodes to, or 0 if the level does not exist. It depends on the type of
+// that image rather than on the samples of the file: RGB and YCbCr levels
+// take 4 bytes per pixel, and 12-bit and 32-bit floating point samples are
+// widened to 16 and 64 bits. Levels that cannot be decoded are counted at
+// whole bytes per stored sample. Decodes are also bound by
+// Options.MaxPixels, which this does not check.
+func (r *Reader) LevelUncompressedBytes(level int) int64 {
+	if r.d.checkLevel(level) != nil {
+		return 0
+	}
+	cfg := r.d.gt.Overviews[level]
+	if len(cfg.BitsPerSample) == 0 {
+		return 0
+	}
+	pixels := int64(cfg.ImageWidth) * int64(cfg.ImageHeight)
+	m := r.d.colorModel(level)
+	switch {
+	case isRGBModel(m):
+		return pixels * 4
+	case sampleSize(m) > 0:
+		return pixels * int64(sampleSize(m))
+	}
+	if _, ok := m.(color.Palette); ok {
+		return pixels
+	}
+	sampleBytes := int64(cfg.BitsPerSample[0]+7) / 8
+	return pixels * int64(cfg.SamplesPerPixel) * sampleBytes
+}
+
+// DecodeLevel decodes the whole image at level.
+func (r *Reader) DecodeLevel(level int) (image.Image, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	cfg := r.d.gt.Overviews[level]
+	rect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
+
+	return decodeLevelSubImage(r.d, level, rect, 1, -1)
 }
 
 func DecodeLevelSubImage(r io.Reader, level int, rect image.Rectangle) (img image.Image, err error) {
@@ -713,7 +2644,7 @@ func DecodeLevelSubImage(r io.Reader, level int, rect image.Rectangle) (img imag
 		return nil, err
 	}
 
-	return decodeLevelSubImage(d, level, rect)
+	return decodeLevelSubImage(d, level, rect, 1, -1)
 }
 
 func DecodeLevel(r io.Reader, level int) (img image.Image, err error) {
@@ -729,7 +2660,7 @@ func DecodeLevel(r io.Reader, level int) (img image.Image, err error) {
 	cfg := d.gt.Overviews[level]
 	rect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
 
-	return decodeLevelSubImage(d, level, rect)
+	return decodeLevelSubImage(d, level, rect, 1, -1)
 }
 
 func Decode(r io.Reader) (img image.Image, err error) {
@@ -745,7 +2676,7 @@ func Decode(r io.Reader) (img image.Image, err error) {
 	cfg := d.gt.Overviews[0]
 	rect := image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight))
 
-	return decodeLevelSubImage(d, 0, rect)
+	return decodeLevelSubImage(d, 0, rect, 1, -1)
 }
 
 func DecodeGeoInfo(r io.Reader) (GeoInfo, error) {
@@ -768,8 +2699,13 @@ func DecodeGeoInfo(r io.Reader) (GeoInfo, error) {
 		return GeoInfo{}, err
 	}
 
+	gt := d.gt.GeoTrans
+	if geo, err := d.gt.geoData(); err == nil && geo.RasterType == PixelIsPoint {
+		gt = gt.pixelIsPoint()
+	}
+
 	info := GeoInfo{Type: dType, Size: [2]uint32{d.gt.Overviews[0].ImageWidth, d.gt.Overviews[0].ImageHeight},
-		GeoTrans: d.gt.GeoTrans, Proj4: proj4, NoData: d.gt.NoData}
+		GeoTrans: gt, Proj4: proj4, NoData: d.gt.NoData}
 
 	for i := 0; i < len(d.gt.Overviews); i++ {
 		info.Overviews = append(info.Overviews, Overview{Size: [2]uint32{d.gt.Overviews[i].ImageWidth,
@@ -779,6 +2715,88 @@ func DecodeGeoInfo(r io.Reader) (GeoInfo, error) {
 	return info, nil
 }
 
+// DecodeTileBytes decodes a single tile as stored in a TIFF, compressed as
+// described by desc and with samples in byte order bo. It is meant for
+// callers that read tiles and headers themselves, desc usually being one of
+// those returned by ReadImageDescriptors. The returned image has the bounds
+// of the tile, padding included.
+func DecodeTileBytes(raw []byte, desc ImgDesc, bo binary.ByteOrder) (image.Image, error) {
+	if desc.TileWidth == 0 || desc.TileHeight == 0 {
+		return nil, FormatError("tile dimensions must not be 0")
+	}
+	if len(desc.BitsPerSample) == 0 || len(desc.SampleFormat) == 0 {
+		return nil, FormatError("missing BitsPerSample or SampleFormat")
+	}
+	// desc is checked as parseIFD checks the IFDs of a file, a zero
+	// PlanarConfig standing for the default.
+	if desc.PlanarConfig > 2 {
+		return nil, FormatError(fmt.Sprintf("PlanarConfiguration: %d not recognised", desc.PlanarConfig))
+	}
+	if err := desc.checkCodecTags(); err != nil {
+		return nil, err
+	}
+
+	// Describe an image made of this single tile, repeated for each plane
+	// so any band of a planar image reads the same bytes.
+	planes := 1
+	if desc.PlanarConfig == 2 && desc.SamplesPerPixel > 1 {
+		planes = int(desc.SamplesPerPixel)
+	}
+	desc.ImageWidth, desc.ImageHeight = desc.TileWidth, desc.TileHeight
+	desc.TileOffsets = make([]uint32, planes)
+	desc.TileByteCounts = make([]uint32, planes)
+	for i := range desc.TileByteCounts {
+		desc.TileByteCounts[i] = uint32(len(raw))
+	}
+
+	d := decoder{ra: bytes.NewReader(raw), bo: bo, gt: GeoTIFF{Overviews: []ImgDesc{desc}}}
+	return decodeLevelSubImage(d, 0, image.Rect(0, 0, int(desc.TileWidth), int(desc.TileHeight)), 1, -1)
+}
+
+// ReadImageDescriptors parses the IFDs of the TIFF in r and returns the
+// description of each image, the full resolution one first, without
+// decoding any pixels.
+func ReadImageDescriptors(r io.ReaderAt) ([]ImgDesc, error) {
+	d, err := newDecoderAt(r)
+	if err != nil {
+		return nil, err
+	}
+	err = d.readIFD()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.gt.Overviews, nil
+}
+
+// HeaderSize parses the IFDs of the TIFF in r and returns the offset of its
+// first tile. In a COG everything before it, the IFDs, their tag data and
+// the ghost area, is the header, so reading that many bytes up front serves
+// all the metadata reads of a later decode.
+func HeaderSize(r io.ReaderAt) (int64, error) {
+	descs, err := ReadImageDescriptors(r)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(-1)
+	for _, desc := range descs {
+		for i, offset := range desc.TileOffsets {
+			if i >= len(desc.TileByteCounts) || desc.TileByteCounts[i] == 0 {
+				continue
+			}
+			if size < 0 || int64(offset) < size {
+				size = int64(offset)
+			}
+		}
+	}
+	if size < 0 {
+		return 0, FormatError("no tile data found")
+	}
+
+	return size, nil
+}
+
 func DecodeConfigLevel(r io.Reader, level int) (image.Config, error) {
 	d, err := newDecoder(r)
 	if err != nil {
@@ -799,6 +2817,26 @@ func DecodeConfig(r io.Reader) (image.Config, error) {
 	return DecodeConfigLevel(r, 0)
 }
 
+// DecodeConfigAll returns the color model and dimensions of every level
+// in a COG, the full resolution image first followed by its overviews.
+func DecodeConfigAll(r io.Reader) ([]image.Config, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	err = d.readIFD()
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := make([]image.Config, len(d.gt.Overviews))
+	for level, cfg := range d.gt.Overviews {
+		cfgs[level] = image.Config{ColorModel: d.colorModel(level), Width: int(cfg.ImageWidth), Height: int(cfg.ImageHeight)}
+	}
+
+	return cfgs, nil
+}
+
 func init() {
 	image.RegisterFormat("cog", leHeader, Decode, DecodeConfig)
 	image.RegisterFormat("cog", beHeader, Decode, DecodeConfig)
@@ -0,0 +1,897 @@
+package gocog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/terrascope/scimage"
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// testPadding is the value of the samples of test tiles lying past the
+// image, which testSample never returns.
+const testPadding = 0xee
+
+// testSample is the sample at (x, y) of the 8-bit test images.
+func testSample(x, y int) uint8 {
+	return uint8((x + 3*y) % 200)
+}
+
+// testTIFF returns a little-endian TIFF made of a single IFD holding ents,
+// followed by blocks, the tiles or strips it points to. The offsets and
+// byte counts of the blocks are filled in.
+func testTIFF(ents []ifdEntry, blocks [][]byte) []byte {
+	return levelsTIFF(false, testLevel{ents, blocks})
+}
+
+// A testLevel is an IFD of a test file and the blocks its TileOffsets or
+// StripOffsets point to.
+type testLevel struct {
+	ents   []ifdEntry
+	blocks [][]byte
+}
+
+// levelsTIFF returns a little-endian TIFF holding levels, each IFD followed
+// by its blocks. The IFDs are chained in order or, if sub is set, the
+// first one points to the others through its SubIFDs tag.
+func levelsTIFF(sub bool, levels ...testLevel) []byte {
+	ifds := make([][]ifdEntry, len(levels))
+	offsets := make([]int64, len(levels))
+	offset := int64(8)
+	for n, l := range levels {
+		ents := append([]ifdEntry(nil), l.ents...)
+		if sub && n == 0 && len(levels) > 1 {
+			ents = append(ents, ifdEntry{tag: cSubIFDs, datatype: dtLong, data: make([]uint32, len(levels)-1)})
+		}
+		sort.Slice(ents, func(i, j int) bool { return ents[i].tag < ents[j].tag })
+		for i, e := range ents {
+			switch e.tag {
+			case cTileOffsets, cTileByteCounts, cStripOffsets, cStripByteCounts:
+				ents[i].datatype, ents[i].data = dtLong, make([]uint32, len(l.blocks))
+			}
+		}
+		offsets[n] = offset
+		offset += ifdSize(ents)
+		for _, e := range ents {
+			off := offset
+			for k, b := range l.blocks {
+				switch e.tag {
+				case cTileOffsets, cStripOffsets:
+					e.data[k] = uint32(off)
+				case cTileByteCounts, cStripByteCounts:
+					e.data[k] = uint32(len(b))
+				}
+				off += int64(len(b))
+			}
+		}
+		for _, b := range l.blocks {
+			offset += int64(len(b))
+		}
+		ifds[n] = ents
+	}
+	if sub {
+		for _, e := range ifds[0] {
+			if e.tag == cSubIFDs {
+				for k := range e.data {
+					e.data[k] = uint32(offsets[k+1])
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(leHeader)
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	for n, l := range levels {
+		next := int64(0)
+		if !sub && n+1 < len(levels) {
+			next = offsets[n+1]
+		}
+		buf.Write(encodeIFD(ifds[n], offsets[n], next))
+		for _, b := range l.blocks {
+			buf.Write(b)
+		}
+	}
+	return buf.Bytes()
+}
+
+// tiledTIFF returns a single band 8-bit TIFF of w by h pixels holding
+// testSample, in uncompressed tiles of tw by th pixels padded with
+// testPadding. ents replace the tags of the same number, and those without
+// a datatype remove them.
+func tiledTIFF(w, h, tw, th int, ents ...ifdEntry) []byte {
+	return compressedTIFF(w, h, tw, th, nil, ents...)
+}
+
+// compressedTIFF is tiledTIFF with the k-th tile stored as compress returns
+// it, compress being nil for uncompressed tiles. ents should set the
+// Compression tag to match.
+func compressedTIFF(w, h, tw, th int, compress func(k int, tile []byte) []byte, ents ...ifdEntry) []byte {
+	l := tiledLevel(w, h, tw, th, compress, ents...)
+	return testTIFF(l.ents, l.blocks)
+}
+
+// tiledLevel returns the IFD and tiles of the files compressedTIFF
+// returns, to be laid out by levelsTIFF.
+func tiledLevel(w, h, tw, th int, compress func(k int, tile []byte) []byte, ents ...ifdEntry) testLevel {
+	var tiles [][]byte
+	for ty := 0; ty < h; ty += th {
+		for tx := 0; tx < w; tx += tw {
+			tile := make([]byte, tw*th)
+			for y := 0; y < th; y++ {
+				for x := 0; x < tw; x++ {
+					tile[y*tw+x] = testPadding
+					if tx+x < w && ty+y < h {
+						tile[y*tw+x] = testSample(tx+x, ty+y)
+					}
+				}
+			}
+			if compress != nil {
+				tile = compress(len(tiles), tile)
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	return testLevel{withEntries([]ifdEntry{
+		{tag: cImageWidth, datatype: dtLong, data: []uint32{uint32(w)}},
+		{tag: cImageLength, datatype: dtLong, data: []uint32{uint32(h)}},
+		{tag: cBitsPerSample, datatype: dtShort, data: []uint32{8}},
+		{tag: cCompression, datatype: dtShort, data: []uint32{cNone}},
+		{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{pBlackIsZero}},
+		{tag: cSamplesPerPixel, datatype: dtShort, data: []uint32{1}},
+		{tag: cTileWidth, datatype: dtLong, data: []uint32{uint32(tw)}},
+		{tag: cTileLength, datatype: dtLong, data: []uint32{uint32(th)}},
+		{tag: cTileOffsets},
+		{tag: cTileByteCounts},
+	}, ents), tiles}
+}
+
+// withEntries returns ents with the entries of repl replacing those of the
+// same tag, or removing them if they have no datatype.
+func withEntries(ents, repl []ifdEntry) []ifdEntry {
+	var out []ifdEntry
+	for _, e := range ents {
+		replaced := false
+		for _, r := range repl {
+			replaced = replaced || r.tag == e.tag
+		}
+		if !replaced {
+			out = append(out, e)
+		}
+	}
+	for _, r := range repl {
+		if r.datatype != 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// checkSamples checks that img holds the samples want returns for the
+// pixels of the level img was decoded from, its pixel (x, y) being the
+// pixel (x*step, y*step) of the level.
+func checkSamples(t *testing.T, img image.Image, step int, want func(x, y int) uint8) {
+	t.Helper()
+	at, err := sampleAt(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got, w := at(x, y), float64(want(x*step, y*step)); got != w {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, got, w)
+			}
+		}
+	}
+}
+
+func TestDecodeIntoKeepsNeighbours(t *testing.T) {
+	const sentinel = 0xfe
+	file := tiledTIFF(40, 30, 16, 16)
+	dst := scimage.NewGrayU8(image.Rect(0, 0, 50, 50), 0, 0xff)
+	for i := range dst.Pix {
+		dst.Pix[i] = sentinel
+	}
+
+	src, origin := image.Rect(20, 20, 30, 30), image.Pt(5, 8)
+	if err := DecodeInto(bytes.NewReader(file), 0, src, dst, origin); err != nil {
+		t.Fatal(err)
+	}
+	win := src.Sub(src.Min).Add(origin)
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			want := uint8(sentinel)
+			if image.Pt(x, y).In(win) {
+				want = testSample(x-origin.X+src.Min.X, y-origin.Y+src.Min.Y)
+			}
+			if got := dst.Pix[dst.PixOffset(x, y)]; got != want {
+				t.Fatalf("dst pixel (%d, %d): got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeIntoRescaled(t *testing.T) {
+	const sentinel = 0xfedc
+	// Samples from 50 to 150 map to 1000 to 1400 in a GrayU16 image.
+	file := tiledTIFF(40, 30, 16, 16,
+		ifdEntry{tag: cSMinSampleValue, datatype: dtShort, data: []uint32{50}},
+		ifdEntry{tag: cSMaxSampleValue, datatype: dtShort, data: []uint32{150}})
+	dst := scimage.NewGrayU16(image.Rect(0, 0, 50, 50), 1000, 1400)
+	for i := range dst.Pix {
+		dst.Pix[i] = sentinel
+	}
+
+	src, origin := image.Rect(10, 12, 35, 30), image.Pt(20, 3)
+	if err := DecodeIntoRescaled(bytes.NewReader(file), 0, src, dst, origin); err != nil {
+		t.Fatal(err)
+	}
+	win := src.Sub(src.Min).Add(origin)
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			want := uint16(sentinel)
+			if image.Pt(x, y).In(win) {
+				v := float64(testSample(x-origin.X+src.Min.X, y-origin.Y+src.Min.Y))
+				want = uint16(clamp(1000+(v-50)*4, 1000, 1400))
+			}
+			if got := dst.Pix[dst.PixOffset(x, y)]; got != want {
+				t.Fatalf("dst pixel (%d, %d): got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestFullLevelSetsOnlyRect(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(tiledTIFF(40, 30, 16, 16)), &Options{FullLevel: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect := image.Rect(20, 20, 30, 30)
+	img, err := r.DecodeLevelSubImage(0, rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b != image.Rect(0, 0, 40, 30) {
+		t.Fatalf("bounds %v, want the whole level", b)
+	}
+	checkSamples(t, img, 1, func(x, y int) uint8 {
+		if image.Pt(x, y).In(rect) {
+			return testSample(x, y)
+		}
+		return 0
+	})
+}
+
+func TestOverviewWindowsAlign(t *testing.T) {
+	// Each 2x2 block of the image is uniform, so that its overview holds
+	// the same samples at half the resolution.
+	src := scimage.NewGrayU8(image.Rect(0, 0, 60, 44), 0, 0xff)
+	for y := 0; y < 44; y++ {
+		for x := 0; x < 60; x++ {
+			src.Pix[src.PixOffset(x, y)] = testSample(x/2, y/2)
+		}
+	}
+	var buf bytes.Buffer
+	gt := Geotransform{100, 2, 0, 500, 0, -2}
+	if err := Encode(&buf, src, &EncodeOptions{TileSize: 16, Overviews: 1, Geotransform: &gt}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The world window from (116, 492) to (156, 460).
+	var imgs [2]image.Image
+	for level := range imgs {
+		lgt, err := r.Geotransform(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x0, y0, _ := lgt.Inverse(116, 492)
+		x1, y1, _ := lgt.Inverse(156, 460)
+		rect := image.Rect(int(x0), int(y0), int(x1), int(y1))
+		if imgs[level], err = r.DecodeLevelSubImage(level, rect); err != nil {
+			t.Fatal(err)
+		}
+		if imgs[level].Bounds() != rect {
+			t.Fatalf("level %d: bounds %v, want %v", level, imgs[level].Bounds(), rect)
+		}
+	}
+	if b0, b1 := imgs[0].Bounds(), imgs[1].Bounds(); b0 != image.Rect(8, 4, 28, 20) || b1 != image.Rect(4, 2, 14, 10) {
+		t.Fatalf("windows %v and %v do not cover the same area", b0, b1)
+	}
+	fine, err := sampleAt(imgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, imgs[1], 1, func(x, y int) uint8 { return uint8(fine(2*x, 2*y)) })
+}
+
+func TestCCITTModifiedHuffmanUnsupported(t *testing.T) {
+	file := tiledTIFF(16, 16, 16, 16,
+		ifdEntry{tag: cBitsPerSample, datatype: dtShort, data: []uint32{1}},
+		ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cCCITT}})
+	_, err := DecodeLevel(bytes.NewReader(file), 0)
+	var ue UnsupportedError
+	if !errors.As(err, &ue) || !strings.Contains(err.Error(), "modified Huffman") {
+		t.Fatalf("got %v, want an UnsupportedError for modified Huffman", err)
+	}
+}
+
+// sampleTIFF returns a single band TIFF of 16 by 16 pixels made of one
+// uncompressed tile holding the samples in raw, with the given
+// photometric interpretation, sample size and format.
+func sampleTIFF(raw []byte, photometric, bits, format uint32) []byte {
+	return testTIFF([]ifdEntry{
+		{tag: cImageWidth, datatype: dtLong, data: []uint32{16}},
+		{tag: cImageLength, datatype: dtLong, data: []uint32{16}},
+		{tag: cBitsPerSample, datatype: dtShort, data: []uint32{bits}},
+		{tag: cCompression, datatype: dtShort, data: []uint32{cNone}},
+		{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{photometric}},
+		{tag: cSamplesPerPixel, datatype: dtShort, data: []uint32{1}},
+		{tag: cTileWidth, datatype: dtLong, data: []uint32{16}},
+		{tag: cTileLength, datatype: dtLong, data: []uint32{16}},
+		{tag: cTileOffsets},
+		{tag: cTileByteCounts},
+		{tag: cSampleFormat, datatype: dtShort, data: []uint32{format}},
+	}, [][]byte{raw})
+}
+
+func TestWhiteIsZeroSigned16(t *testing.T) {
+	stored := func(x, y int) int16 { return int16((x-8)*1000 + y) }
+	raw := make([]byte, 2*16*16)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			binary.LittleEndian.PutUint16(raw[2*(16*y+x):], uint16(stored(x, y)))
+		}
+	}
+	img, err := DecodeLevel(bytes.NewReader(sampleTIFF(raw, pWhiteIsZero, 16, uint32(sintSample))), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s16, ok := img.(*scimage.GrayS16)
+	if !ok {
+		t.Fatalf("decoded a %T, want a *scimage.GrayS16", img)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			// The signed range is reversed: -8000 becomes 7999.
+			if got, want := s16.GrayS16At(x, y).Y, ^stored(x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestWhiteIsZeroFloatBand(t *testing.T) {
+	raw := make([]byte, 8*16*16)
+	for i := 0; i < 16*16; i++ {
+		binary.LittleEndian.PutUint64(raw[8*i:], math.Float64bits(float64(i)-0.5))
+	}
+	r, err := NewReader(bytes.NewReader(sampleTIFF(raw, pWhiteIsZero, 64, uint32(ieeefpSample))), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.DecodeBand(0, 0, image.Rect(0, 0, 16, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := sampleAt(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := at(3, 2); got != 34.5 {
+		t.Fatalf("sample %v, want the stored 34.5", got)
+	}
+}
+
+func TestGeotransformRasterType(t *testing.T) {
+	gt := Geotransform{1000, 30, 0, 2000, 0, -30}
+	img := testImage(t, scicolor.GrayU8Model{Min: 0, Max: 0xff}, image.Rect(0, 0, 20, 10), func(x, y int) float64 { return 1 })
+	tests := []struct {
+		rasterType uint16
+		want       Geotransform
+	}{
+		{1, gt},
+		// The tiepoint refers to the centre of the first pixel, so its
+		// corner lies half a pixel up and left.
+		{2, Geotransform{985, 30, 0, 2015, 0, -30}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, &EncodeOptions{Overviews: 1, Geotransform: &gt, GeoKeys: sinusoidalKeys(tt.rasterType)}); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for level, want := range []Geotransform{tt.want, tt.want.scale(2, 2)} {
+			if got, err := r.Geotransform(level); err != nil || got != want {
+				t.Fatalf("raster type %d, level %d: got %v, %v, want %v", tt.rasterType, level, got, err, want)
+			}
+		}
+		info, err := DecodeGeoInfo(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.GeoTrans != tt.want {
+			t.Fatalf("raster type %d: DecodeGeoInfo geotransform %v, want %v", tt.rasterType, info.GeoTrans, tt.want)
+		}
+	}
+}
+
+func TestOversizedTile(t *testing.T) {
+	// The tile of 16 by 16 pixels decompresses to twice its size.
+	file := compressedTIFF(16, 16, 16, 16, func(k int, tile []byte) []byte {
+		z, err := deflateTile(append(tile, tile...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return z
+	}, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cDeflate}})
+
+	// By default the excess is logged and the tile decoded.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	img, err := DecodeLevel(bytes.NewReader(file), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 1, testSample)
+	if !strings.Contains(logged.String(), "decompressed to 512 bytes, expected 256") {
+		t.Fatalf("logged %q, want a warning about the tile size", logged.String())
+	}
+
+	r, err := NewReader(bytes.NewReader(file), &Options{StrictTileSize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fe FormatError
+	if _, err := r.DecodeLevel(0); !errors.As(err, &fe) {
+		t.Fatalf("got %v, want a FormatError with StrictTileSize", err)
+	}
+}
+
+// endless is a reader of zeros without an end.
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestStrictTileSizeStopsDecompression(t *testing.T) {
+	// Tiles of this private compression decompress to endless data, which
+	// would exhaust the memory unless reading stops.
+	const endlessCompression = 65001
+	RegisterDecompressor(endlessCompression, func(r io.Reader) io.ReadCloser { return io.NopCloser(endless{}) })
+	file := tiledTIFF(16, 16, 16, 16, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{endlessCompression}})
+
+	r, err := NewReader(bytes.NewReader(file), &Options{StrictTileSize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fe FormatError
+	if _, err := r.DecodeLevel(0); !errors.As(err, &fe) || !strings.Contains(err.Error(), "more than 271 bytes") {
+		t.Fatalf("got %v, want a FormatError for the endless tile", err)
+	}
+}
+
+func TestBareBaselineTIFF(t *testing.T) {
+	// Only the size and strip tags are set, so the image is a single
+	// strip of 1-bit BlackIsZero samples.
+	const w, h = 20, 5
+	bit := func(x, y int) uint8 {
+		if (x+y)%3 == 0 {
+			return 1
+		}
+		return 0
+	}
+	strip := make([]byte, h*3)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			strip[3*y+x/8] |= bit(x, y) << (7 - uint(x%8))
+		}
+	}
+	file := testTIFF([]ifdEntry{
+		{tag: cImageWidth, datatype: dtShort, data: []uint32{w}},
+		{tag: cImageLength, datatype: dtShort, data: []uint32{h}},
+		{tag: cStripOffsets},
+		{tag: cStripByteCounts},
+	}, [][]byte{strip})
+
+	img, err := DecodeLevel(bytes.NewReader(file), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b != image.Rect(0, 0, w, h) {
+		t.Fatalf("bounds %v", b)
+	}
+	checkSamples(t, img, 1, bit)
+}
+
+func TestStrippedOverview(t *testing.T) {
+	// A tiled level 0 and a 20 by 15 overview in strips of 8 rows.
+	const w, h, rows = 20, 15, 8
+	var strips [][]byte
+	for y0 := 0; y0 < h; y0 += rows {
+		var strip []byte
+		for y := y0; y < y0+rows && y < h; y++ {
+			for x := 0; x < w; x++ {
+				strip = append(strip, testSample(x, y))
+			}
+		}
+		strips = append(strips, strip)
+	}
+	file := levelsTIFF(false, tiledLevel(40, 30, 16, 16, nil), testLevel{[]ifdEntry{
+		{tag: cNewSubfileType, datatype: dtLong, data: []uint32{sfReducedImage}},
+		{tag: cImageWidth, datatype: dtLong, data: []uint32{w}},
+		{tag: cImageLength, datatype: dtLong, data: []uint32{h}},
+		{tag: cBitsPerSample, datatype: dtShort, data: []uint32{8}},
+		{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{pBlackIsZero}},
+		{tag: cRowsPerStrip, datatype: dtLong, data: []uint32{rows}},
+		{tag: cStripOffsets},
+		{tag: cStripByteCounts},
+	}, strips})
+
+	r, err := NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.NumLevels(); n != 2 {
+		t.Fatalf("%d levels, want 2", n)
+	}
+	for level, size := range []image.Point{{40, 30}, {w, h}} {
+		if got, err := r.LevelSize(level); err != nil || got != size {
+			t.Fatalf("level %d: size %v, %v, want %v", level, got, err, size)
+		}
+		img, err := r.DecodeLevel(level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if b := img.Bounds(); b.Size() != size {
+			t.Fatalf("level %d: bounds %v, want %v", level, b, size)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+}
+
+func TestEdgeTilePadding(t *testing.T) {
+	// The right column of tiles holds 44 columns of the image and 212 of
+	// padding, the bottom row 14 rows and 242 of padding.
+	r, err := NewReader(bytes.NewReader(tiledTIFF(300, 270, 256, 256)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(0, 0, 300, 270),
+		image.Rect(250, 250, 400, 400),
+		image.Rect(256, 0, 300, 270),
+	} {
+		img, err := r.DecodeLevelSubImage(0, rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := rect.Intersect(image.Rect(0, 0, 300, 270)); img.Bounds() != want {
+			t.Fatalf("bounds %v, want %v", img.Bounds(), want)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+	img, err := r.DecodeLevelSubImageDecimated(0, image.Rect(0, 0, 300, 270), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 3, testSample)
+}
+
+func TestCircularIFDChain(t *testing.T) {
+	file := tiledTIFF(16, 16, 16, 16)
+	// Point the next IFD offset, after the 10 entries of the IFD at 8,
+	// back to the IFD itself.
+	binary.LittleEndian.PutUint32(file[8+2+ifdLen*10:], 8)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewReader(bytes.NewReader(file), nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var fe FormatError
+		if !errors.As(err, &fe) || !strings.Contains(err.Error(), "circular") {
+			t.Fatalf("got %v, want a FormatError for the circular chain", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("parsing a self-referential IFD did not terminate")
+	}
+}
+
+func TestNextIFDPastEOF(t *testing.T) {
+	file := tiledTIFF(16, 16, 16, 16)
+	// Point the next IFD offset, after the 10 entries of the IFD at 8,
+	// past the end of the file.
+	binary.LittleEndian.PutUint32(file[8+2+ifdLen*10:], uint32(len(file)+100))
+
+	_, err := NewReader(bytes.NewReader(file), nil)
+	var fe FormatError
+	if !errors.As(err, &fe) || !strings.Contains(err.Error(), "beyond end of file") {
+		t.Fatalf("got %v, want a FormatError for the offset past the end", err)
+	}
+}
+
+func TestSamplesPerPixelDefault(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(tiledTIFF(40, 30, 16, 16, ifdEntry{tag: cSamplesPerPixel})), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spp := r.d.gt.Overviews[0].SamplesPerPixel; spp != 1 {
+		t.Fatalf("SamplesPerPixel %d, want the default of 1", spp)
+	}
+	img, err := r.DecodeLevel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*scimage.GrayU8); !ok {
+		t.Fatalf("decoded a %T, want a single band *scimage.GrayU8", img)
+	}
+	checkSamples(t, img, 1, testSample)
+	if _, err := r.DecodeBand(0, 1, image.Rect(0, 0, 10, 10)); err == nil {
+		t.Fatal("decoded a second band")
+	}
+}
+
+func TestMaxPixels(t *testing.T) {
+	file := tiledTIFF(40, 30, 16, 16)
+	r, err := NewReader(bytes.NewReader(file), &Options{MaxPixels: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ue UnsupportedError
+	if _, err := r.DecodeLevel(0); !errors.As(err, &ue) {
+		t.Fatalf("got %v, want an UnsupportedError for 1200 pixels", err)
+	}
+	if _, err := r.DecodeLevelSubImage(0, image.Rect(0, 0, 40, 25)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers default to DefaultMaxPixels, the package-level functions to
+	// no limit.
+	if r, err = NewReader(bytes.NewReader(file), nil); err != nil {
+		t.Fatal(err)
+	}
+	if max := r.d.opts.maxPixels(); max != DefaultMaxPixels {
+		t.Fatalf("Reader limit %d, want DefaultMaxPixels", max)
+	}
+	d, err := newDecoder(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := d.opts.maxPixels(); max != math.MaxInt64 {
+		t.Fatalf("package-level limit %d, want none", max)
+	}
+}
+
+func TestDecodeTileBytes(t *testing.T) {
+	desc := ImgDesc{TileWidth: 16, TileHeight: 16, SamplesPerPixel: 1, BitsPerSample: []uint16{8}, SampleFormat: []uint16{1},
+		Compression: cNone, PhotometricInterpr: pBlackIsZero, PlanarConfig: 1}
+	raw := make([]byte, 16*16)
+	for i := range raw {
+		raw[i] = testSample(i%16, i/16)
+	}
+	img, err := DecodeTileBytes(raw, desc, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 1, testSample)
+
+	// Descriptions a file could not hold are rejected rather than
+	// decoded.
+	ycbcr := desc
+	ycbcr.PhotometricInterpr, ycbcr.SamplesPerPixel, ycbcr.BitsPerSample = pYCbCr, 3, []uint16{8, 8, 8}
+	planar := desc
+	planar.PlanarConfig = 3
+	for name, bad := range map[string]ImgDesc{"zero YCbCrSubSampling": ycbcr, "PlanarConfig 3": planar} {
+		var fe FormatError
+		if _, err := DecodeTileBytes(make([]byte, 3*16*16), bad, binary.LittleEndian); !errors.As(err, &fe) {
+			t.Fatalf("%s: got %v, want a FormatError", name, err)
+		}
+	}
+}
+
+func TestLevelUncompressedBytes(t *testing.T) {
+	// Each tile stores its gray samples three times, as RGB.
+	rgb := compressedTIFF(40, 30, 16, 16, func(k int, tile []byte) []byte {
+		out := make([]byte, 0, 3*len(tile))
+		for _, v := range tile {
+			out = append(out, v, v, v)
+		}
+		return out
+	}, ifdEntry{tag: cSamplesPerPixel, datatype: dtShort, data: []uint32{3}},
+		ifdEntry{tag: cBitsPerSample, datatype: dtShort, data: []uint32{8, 8, 8}},
+		ifdEntry{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{pRGB}})
+
+	for name, file := range map[string][]byte{"gray": tiledTIFF(40, 30, 16, 16), "RGB": rgb} {
+		r, err := NewReader(bytes.NewReader(file), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := r.DecodeLevel(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var size int
+		switch img := img.(type) {
+		case *scimage.GrayU8:
+			size = len(img.Pix)
+		case *image.RGBA:
+			size = len(img.Pix)
+		default:
+			t.Fatalf("%s: decoded a %T", name, img)
+		}
+		if got := r.LevelUncompressedBytes(0); got != int64(size) {
+			t.Fatalf("%s: %d bytes, the decoded image takes %d", name, got, size)
+		}
+	}
+}
+
+func TestBottomEdgeTilesPredictor(t *testing.T) {
+	// 30 rows make a bottom row of tiles holding 14 rows of the image and
+	// 2 of padding, compressed with the horizontal predictor.
+	file := compressedTIFF(40, 30, 16, 16, func(k int, tile []byte) []byte {
+		diff := append([]byte(nil), tile...)
+		for i := len(diff) - 1; i > 0; i-- {
+			if i%16 != 0 {
+				diff[i] -= diff[i-1]
+			}
+		}
+		z, err := deflateTile(diff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return z
+	}, ifdEntry{tag: cCompression, datatype: dtShort, data: []uint32{cDeflate}},
+		ifdEntry{tag: cPredictor, datatype: dtShort, data: []uint32{prHorizontal}})
+
+	r, err := NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rect := range []image.Rectangle{image.Rect(0, 0, 40, 30), image.Rect(0, 16, 40, 30), image.Rect(30, 20, 40, 30)} {
+		img, err := r.DecodeLevelSubImage(0, rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != rect {
+			t.Fatalf("bounds %v, want %v", img.Bounds(), rect)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+}
+
+func TestSubIFDOverview(t *testing.T) {
+	file := levelsTIFF(true,
+		tiledLevel(40, 30, 16, 16, nil),
+		tiledLevel(20, 15, 16, 16, nil, ifdEntry{tag: cNewSubfileType, datatype: dtLong, data: []uint32{sfReducedImage}}),
+	)
+	r, err := NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.NumLevels(); n != 2 {
+		t.Fatalf("%d levels, want 2", n)
+	}
+	img, err := r.DecodeLevel(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b != image.Rect(0, 0, 20, 15) {
+		t.Fatalf("overview bounds %v, want 20x15", b)
+	}
+	checkSamples(t, img, 1, testSample)
+}
+
+func TestSkipBadIFDs(t *testing.T) {
+	reduced := ifdEntry{tag: cNewSubfileType, datatype: dtLong, data: []uint32{sfReducedImage}}
+	file := levelsTIFF(false,
+		tiledLevel(40, 30, 16, 16, nil),
+		tiledLevel(20, 15, 16, 16, nil, reduced, ifdEntry{tag: cImageWidth, datatype: dtLong, data: []uint32{20, 20}}),
+		tiledLevel(10, 8, 16, 16, nil, reduced),
+	)
+	if _, err := NewReader(bytes.NewReader(file), nil); err == nil {
+		t.Fatal("opened a file with a corrupt IFD")
+	}
+
+	r, err := NewReader(bytes.NewReader(file), &Options{SkipBadIFDs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.NumLevels(); n != 2 {
+		t.Fatalf("%d levels, want 2", n)
+	}
+	for level, size := range []image.Point{{40, 30}, {10, 8}} {
+		img, err := r.DecodeLevel(level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if b := img.Bounds(); b.Size() != size {
+			t.Fatalf("level %d: bounds %v, want %v", level, b, size)
+		}
+		checkSamples(t, img, 1, testSample)
+	}
+}
+
+func TestTileIndexColumnMajor(t *testing.T) {
+	// 3 tiles across and 2 down, stored column by column.
+	l := tiledLevel(40, 30, 16, 16, nil)
+	const across, down = 3, 2
+	blocks := make([][]byte, len(l.blocks))
+	for j := 0; j < down; j++ {
+		for i := 0; i < across; i++ {
+			blocks[i*down+j] = l.blocks[j*across+i]
+		}
+	}
+	file := testTIFF(l.ents, blocks)
+
+	colMajor := func(i, j, across, down int) int { return i*down + j }
+	r, err := NewReader(bytes.NewReader(file), &Options{TileIndex: colMajor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.DecodeLevel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSamples(t, img, 1, testSample)
+
+	outside := func(i, j, across, down int) int { return across * down }
+	r, err = NewReader(bytes.NewReader(file), &Options{TileIndex: outside})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.DecodeLevel(0); err == nil || !strings.Contains(err.Error(), "outside the 3x2 grid") {
+		t.Fatalf("got %v, want an error for the index outside the grid", err)
+	}
+}
+
+func TestDecode12Bit(t *testing.T) {
+	stored := func(x, y int) uint16 { return uint16((x*257 + y*61) % 4096) }
+	// Two samples are packed in three bytes, most significant bits first.
+	raw := make([]byte, 0, 16*16*3/2)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x += 2 {
+			a, b := stored(x, y), stored(x+1, y)
+			raw = append(raw, uint8(a>>4), uint8(a<<4)|uint8(b>>8), uint8(b))
+		}
+	}
+	img, err := DecodeLevel(bytes.NewReader(sampleTIFF(raw, pBlackIsZero, 12, uint32(uintSample))), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u16, ok := img.(*scimage.GrayU16)
+	if !ok {
+		t.Fatalf("decoded a %T, want a *scimage.GrayU16", img)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if got, want := u16.GrayU16At(x, y).Y, stored(x, y); got != want {
+				t.Fatalf("pixel (%d, %d): got %#x, want %#x", x, y, got, want)
+			}
+		}
+	}
+}
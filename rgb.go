@@ -0,0 +1,156 @@
+package gocog
+
+import (
+	"image"
+	"image/color"
+)
+
+// rgbAlpha returns the ExtraSamples value of the alpha sample following
+// the color samples of cfg: 1 for premultiplied alpha, 2 for straight
+// alpha and 0 if the pixels have none.
+func rgbAlpha(cfg ImgDesc) uint16 {
+	if cfg.SamplesPerPixel < 4 || len(cfg.ExtraSamples) == 0 {
+		return 0
+	}
+	if es := cfg.ExtraSamples[0]; es == 1 || es == 2 {
+		return es
+	}
+	return 0
+}
+
+// rgbChannels returns the number of samples of cfg decoded into the
+// channels of RGBA images: the color samples and the alpha one, if any.
+func rgbChannels(cfg ImgDesc) int {
+	if rgbAlpha(cfg) != 0 {
+		return 4
+	}
+	return 3
+}
+
+// rgbModel returns the color model of the RGB images described by cfg, or
+// nil if their samples are not 8-bit unsigned integers. Options.AlphaMode
+// selects between premultiplied and straight alpha.
+func (d *decoder) rgbModel(cfg ImgDesc) color.Model {
+	if cfg.SamplesPerPixel < 3 {
+		return nil
+	}
+	for k := 0; k < rgbChannels(cfg); k++ {
+		if cfg.BitsPerSample[minInt(k, len(cfg.BitsPerSample)-1)] != 8 {
+			return nil
+		}
+		if len(cfg.SampleFormat) > 0 && sampleFormat(cfg.SampleFormat[minInt(k, len(cfg.SampleFormat)-1)]) != uintSample {
+			return nil
+		}
+	}
+
+	mode := AlphaAsStored
+	if d.opts != nil {
+		mode = d.opts.AlphaMode
+	}
+	switch {
+	case mode == AlphaPremultiplied:
+		return color.RGBAModel
+	case mode == AlphaStraight, rgbAlpha(cfg) == 2:
+		return color.NRGBAModel
+	}
+	return color.RGBAModel
+}
+
+// isRGBModel reports whether images of model m are decoded from RGB
+// samples.
+func isRGBModel(m color.Model) bool {
+	return m == color.RGBAModel || m == color.NRGBAModel
+}
+
+// rgbPix returns the pixels, stride and bounds of the RGBA or NRGBA image
+// img.
+func rgbPix(img image.Image) (pix []uint8, stride int, rect image.Rectangle, ok bool) {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img.Pix, img.Stride, img.Rect, true
+	case *image.NRGBA:
+		return img.Pix, img.Stride, img.Rect, true
+	}
+	return nil, 0, image.Rectangle{}, false
+}
+
+// decodeRGBTiles decodes the tiles of level covering t.clip into the RGBA
+// or NRGBA image of t, one plane at a time for planar files. Pixels without
+// an alpha sample are opaque, and the alpha of the file is premultiplied or
+// not to suit the image.
+func (d *decoder) decodeRGBTiles(level int, t target) error {
+	cfg := d.gt.Overviews[level]
+	pix, _, _, _ := rgbPix(t.img)
+	alpha := rgbAlpha(cfg)
+	if alpha == 0 {
+		for i := 3; i < len(pix); i += 4 {
+			pix[i] = 0xff
+		}
+	}
+
+	planes := 1
+	if cfg.PlanarConfig == 2 {
+		planes = rgbChannels(cfg)
+	}
+	for c := 0; c < planes; c++ {
+		if err := d.decodeTiles(level, t, c); err != nil {
+			return err
+		}
+	}
+
+	_, straight := t.img.(*image.NRGBA)
+	switch {
+	case alpha == 1 && straight:
+		for i := 0; i+4 <= len(pix); i += 4 {
+			c := color.NRGBAModel.Convert(color.RGBA{pix[i], pix[i+1], pix[i+2], pix[i+3]}).(color.NRGBA)
+			pix[i], pix[i+1], pix[i+2] = c.R, c.G, c.B
+		}
+	case alpha == 2 && !straight:
+		for i := 0; i+4 <= len(pix); i += 4 {
+			c := color.RGBAModel.Convert(color.NRGBA{pix[i], pix[i+1], pix[i+2], pix[i+3]}).(color.RGBA)
+			pix[i], pix[i+1], pix[i+2] = c.R, c.G, c.B
+		}
+	}
+	return nil
+}
+
+// decodeRGB decodes the 8-bit samples in d.buf into the RGBA or NRGBA
+// image of t. The pixels of chunky files hold their color and alpha samples
+// among their spp ones, while the tiles of planar files hold the single
+// channel plane.
+func (d *decoder) decodeRGB(t target, cfg ImgDesc, blk image.Rectangle, plane int) error {
+	pix, pstride, rect, _ := rgbPix(t.img)
+	clip, step, dx, dy := t.clip, t.step, t.delta.X, t.delta.Y
+	if cfg.BitsPerSample[0] != 8 {
+		return UnsupportedError("RGB samples other than 8-bit")
+	}
+
+	if cfg.PhotometricInterpr == pYCbCr {
+		return d.decodeYCbCr(t, cfg, blk)
+	}
+
+	spp, nc := 1, 1
+	if cfg.PlanarConfig != 2 {
+		spp, nc, plane = int(cfg.SamplesPerPixel), rgbChannels(cfg), 0
+	}
+	rMaxX := minInt(blk.Max.X, clip.Max.X)
+	rMaxY := minInt(blk.Max.Y, clip.Max.Y)
+
+	off := 0
+	for y := blk.Min.Y; y < rMaxY; y++ {
+		for x := blk.Min.X; x < rMaxX; x++ {
+			if off+spp > len(d.buf) {
+				return errNoPixels
+			}
+			if t.keeps(x, y) {
+				if p := image.Pt(x/step+dx, y/step+dy); p.In(rect) {
+					i := (p.Y-rect.Min.Y)*pstride + (p.X-rect.Min.X)*4 + plane
+					copy(pix[i:i+nc], d.buf[off:off+nc])
+				}
+			}
+			off += spp
+		}
+		off += spp * (blk.Max.X - rMaxX)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package gocog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Samples holds the raw sample values of every band of a rectangle of
+// pixels, whatever their size and format.
+type Samples struct {
+	Rect  image.Rectangle
+	Bands int
+	// Data holds the samples of each pixel in turn, row after row.
+	Data []float64
+}
+
+// At returns the samples of the pixel at x, y, or nil if it is outside
+// s.Rect. The returned slice shares the memory of s.Data.
+func (s *Samples) At(x, y int) []float64 {
+	if !(image.Point{x, y}.In(s.Rect)) {
+		return nil
+	}
+	i := ((y-s.Rect.Min.Y)*s.Rect.Dx() + x - s.Rect.Min.X) * s.Bands
+	return s.Data[i : i+s.Bands]
+}
+
+// DecodeSamples decodes all the bands of the part of the image at level
+// that intersects rect as plain numbers, leaving their interpretation to
+// the caller. It is slower than the typed decodes but handles any number
+// of samples of up to 32 bits, 64 bits for floating point and byte aligned
+// integers, signed or not, such as those of a 5-band 16-bit signed image.
+// The photometric interpretation of the image is not applied.
+func (r *Reader) DecodeSamples(level int, rect image.Rectangle) (*Samples, error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return nil, err
+	}
+	cfg := r.d.gt.Overviews[level]
+	if cfg.ImageWidth == 0 || cfg.ImageHeight == 0 || cfg.TileWidth == 0 || cfg.TileHeight == 0 {
+		return nil, FormatError("unexpected image dimensions")
+	}
+	rect = rect.Intersect(image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)))
+	if rect.Empty() {
+		return nil, fmt.Errorf("the rectangle provided does not intersect the image")
+	}
+	if n, max := int64(rect.Dx())*int64(rect.Dy()), r.d.opts.maxPixels(); n > max {
+		return nil, UnsupportedError(fmt.Sprintf("image of %d pixels exceeds the limit of %d", n, max))
+	}
+	read, err := cfg.sampleReader(r.d.bo)
+	if err != nil {
+		return nil, err
+	}
+
+	bands := int(cfg.SamplesPerPixel)
+	s := &Samples{Rect: rect, Bands: bands, Data: make([]float64, rect.Dx()*rect.Dy()*bands)}
+
+	// Chunky tiles hold all the bands, separate planes one each.
+	planes, spp := 1, bands
+	if cfg.PlanarConfig == 2 {
+		planes, spp = bands, 1
+	}
+	tw, th := int(cfg.TileWidth), int(cfg.TileHeight)
+	across, down := ceilDiv(int(cfg.ImageWidth), tw), ceilDiv(int(cfg.ImageHeight), th)
+	rowBits := tw * spp * int(cfg.BitsPerSample[0])
+	rowBytes := (rowBits + 7) / 8
+	row := make([]float64, tw*spp)
+
+	d := r.d
+	for plane := 0; plane < planes; plane++ {
+		for j := rect.Min.Y / th; j <= (rect.Max.Y-1)/th; j++ {
+			for i := rect.Min.X / tw; i <= (rect.Max.X-1)/tw; i++ {
+				idx, err := d.tileIndex(i, j, across, down)
+				if err != nil {
+					return nil, err
+				}
+				tile := plane*across*down + idx
+				offset, n, err := cfg.tileLocation(tile)
+				if err != nil {
+					return nil, err
+				}
+				if err = d.readTile(cfg, d.ra, tile, offset, n); err != nil {
+					return nil, fmt.Errorf("tile %d: %w", tile, err)
+				}
+
+				blk := image.Rect(i*tw, j*th, (i+1)*tw, (j+1)*th).Intersect(rect)
+				for y := blk.Min.Y; y < blk.Max.Y; y++ {
+					start := (y - j*th) * rowBytes
+					if start+rowBytes > len(d.buf) {
+						return nil, fmt.Errorf("tile %d: %w", tile, errNoPixels)
+					}
+					read(d.buf[start:start+rowBytes], row, spp)
+					for x := blk.Min.X; x < blk.Max.X; x++ {
+						px := s.At(x, y)
+						if planes > 1 {
+							px[plane] = row[x-i*tw]
+						} else {
+							copy(px, row[(x-i*tw)*spp:(x-i*tw+1)*spp])
+						}
+					}
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// sampleReader returns a function reading the samples of a row of a tile
+// of the image described by cfg, interleaved spp at a time, into dst. The
+// predictor is undone in the process, which may alter src.
+func (cfg ImgDesc) sampleReader(bo binary.ByteOrder) (func(src []byte, dst []float64, spp int), error) {
+	bits := int(cfg.BitsPerSample[0])
+	for _, b := range cfg.BitsPerSample {
+		if int(b) != bits {
+			return nil, UnsupportedError(fmt.Sprintf("BitsPerSample of %v", cfg.BitsPerSample))
+		}
+	}
+	format := sampleFormat(cfg.SampleFormat[0])
+	switch {
+	case bits == 0:
+		return nil, FormatError("BitsPerSample must not be 0")
+	case format == ieeefpSample && bits != 32 && bits != 64:
+		return nil, UnsupportedError(fmt.Sprintf("floating point samples of %d bits", bits))
+	case format != ieeefpSample && bits > 32 && bits != 64:
+		return nil, UnsupportedError(fmt.Sprintf("integer samples of %d bits", bits))
+	case cfg.Predictor == prHorizontal && (format == ieeefpSample || bits%8 != 0):
+		return nil, UnsupportedError(fmt.Sprintf("horizontal predictor with %d-bit samples", bits))
+	case cfg.Predictor == prFloatingPoint && format != ieeefpSample:
+		return nil, UnsupportedError("floating point predictor with integer samples")
+	}
+
+	// raw returns the k-th sample of src, packed most significant bit
+	// first unless byte aligned, when it is in byte order bo.
+	raw := func(src []byte, k int) uint64 {
+		switch bits {
+		case 8:
+			return uint64(src[k])
+		case 16:
+			return uint64(bo.Uint16(src[2*k:]))
+		case 32:
+			return uint64(bo.Uint32(src[4*k:]))
+		case 64:
+			return bo.Uint64(src[8*k:])
+		}
+		var v uint64
+		for b := k * bits; b < (k+1)*bits; b++ {
+			v = v<<1 | uint64(src[b/8]>>(7-uint(b%8))&1)
+		}
+		return v
+	}
+	mask := uint64(math.MaxUint64)
+	if bits < 64 {
+		mask = 1<<uint(bits) - 1
+	}
+
+	return func(src []byte, dst []float64, spp int) {
+		if cfg.Predictor == prFloatingPoint {
+			undoFloatPredictor(src[:len(dst)*bits/8], spp, bits/8, bo)
+		}
+		prev := make([]uint64, spp)
+		for k := range dst {
+			v := raw(src, k)
+			if cfg.Predictor == prHorizontal {
+				if k >= spp {
+					v = (v + prev[k%spp]) & mask
+				}
+				prev[k%spp] = v
+			}
+			switch format {
+			case sintSample:
+				// Sign extend.
+				dst[k] = float64(int64(v<<uint(64-bits)) >> uint(64-bits))
+			case ieeefpSample:
+				if bits == 32 {
+					dst[k] = float64(math.Float32frombits(uint32(v)))
+				} else {
+					dst[k] = math.Float64frombits(v)
+				}
+			default:
+				dst[k] = float64(v)
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,183 @@
+package gocog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/terrascope/scimage"
+)
+
+// sharedTIFF returns a little-endian TIFF holding levels, the first one and
+// its overviews, each in its IFD and in uncompressed tiles of ts by ts
+// pixels.
+func sharedTIFF(levels []image.Image, ts int) ([]byte, error) {
+	type entry struct {
+		tag, datatype uint16
+		values        []uint32
+	}
+	le := binary.LittleEndian
+	file := make([]byte, 8)
+	copy(file, leHeader)
+	le.PutUint32(file[4:], 8)
+
+	for k, img := range levels {
+		tiles, err := tileData(img, ts, ts)
+		if err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		subfile := uint32(0)
+		if k > 0 {
+			subfile = sfReducedImage
+		}
+		offsets, counts := make([]uint32, len(tiles)), make([]uint32, len(tiles))
+		ents := []entry{
+			{cNewSubfileType, dtLong, []uint32{subfile}},
+			{cImageWidth, dtLong, []uint32{uint32(b.Dx())}},
+			{cImageLength, dtLong, []uint32{uint32(b.Dy())}},
+			{cBitsPerSample, dtShort, []uint32{uint32(8 * sampleSize(img.ColorModel()))}},
+			{cCompression, dtShort, []uint32{cNone}},
+			{cPhotometricInterpr, dtShort, []uint32{pBlackIsZero}},
+			{cTileWidth, dtLong, []uint32{uint32(ts)}},
+			{cTileLength, dtLong, []uint32{uint32(ts)}},
+			{cTileOffsets, dtLong, offsets},
+			{cTileByteCounts, dtLong, counts},
+		}
+
+		// The IFD is followed by the tile offsets and byte counts, unless
+		// they fit in their entries, and then by the tiles.
+		head := make([]byte, 2+ifdLen*len(ents)+4)
+		ext := len(file) + len(head)
+		data := ext
+		if len(tiles) > 1 {
+			data += 2 * 4 * len(tiles)
+		}
+		for i, t := range tiles {
+			offsets[i], counts[i] = uint32(data), uint32(len(t))
+			data += len(t)
+		}
+
+		le.PutUint16(head, uint16(len(ents)))
+		var arrays []byte
+		for i, e := range ents {
+			p := head[2+ifdLen*i:]
+			le.PutUint16(p[0:2], e.tag)
+			le.PutUint16(p[2:4], e.datatype)
+			le.PutUint32(p[4:8], uint32(len(e.values)))
+			switch {
+			case len(e.values) > 1:
+				le.PutUint32(p[8:12], uint32(ext+len(arrays)))
+				for _, v := range e.values {
+					arrays = append(arrays, 0, 0, 0, 0)
+					le.PutUint32(arrays[len(arrays)-4:], v)
+				}
+			case e.datatype == dtShort:
+				le.PutUint16(p[8:10], uint16(e.values[0]))
+			default:
+				le.PutUint32(p[8:12], e.values[0])
+			}
+		}
+		if k+1 < len(levels) {
+			le.PutUint32(head[len(head)-4:], uint32(data))
+		}
+
+		file = append(file, head...)
+		file = append(file, arrays...)
+		for _, t := range tiles {
+			file = append(file, t...)
+		}
+	}
+	return file, nil
+}
+
+// TestReaderSharedFile decodes overlapping windows of one Reader over an
+// *os.File from many goroutines. Run it with -race.
+func TestReaderSharedFile(t *testing.T) {
+	src := scimage.NewGrayU16(image.Rect(0, 0, 200, 150), 0, 0xffff)
+	set, err := sampleSetter(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			set(x, y, float64(x*300+y))
+		}
+	}
+	ovrs, err := BuildOverviews(src, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []image.Image{src, ovrs[0]}
+	file, err := sharedTIFF(want, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "shared.tif")
+	if err := os.WriteFile(name, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, decodes = 32, 20
+	errs := make(chan error, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := 0; k < decodes; k++ {
+				level := k % 2
+				x, y := (g*37+k*11)%180>>level, (g*13+k*7)%130>>level
+				img, err := r.DecodeLevelSubImage(level, image.Rect(x, y, x+20+k, y+15+g%10))
+				if err == nil {
+					err = sameSamples(img, want[level])
+				}
+				if err != nil {
+					errs <- fmt.Errorf("goroutine %d, decode %d: %w", g, k, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// sameSamples reports the first sample of img differing from that of
+// want at the same position.
+func sameSamples(img, want image.Image) error {
+	at, err := sampleAt(img)
+	if err != nil {
+		return err
+	}
+	wat, err := sampleAt(want)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if g, w := at(x, y), wat(x, y); g != w {
+				return fmt.Errorf("pixel (%d, %d): got %v, want %v", x, y, g, w)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package gocog
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// A DecodedTile is a tile sent by StreamTiles.
+type DecodedTile struct {
+	// Rect holds the bounds of the tile in the pixel coordinates of its
+	// level, clipped to the image. They are also the bounds of Image.
+	Rect  image.Rectangle
+	Image image.Image
+}
+
+// StreamTiles decodes all the tiles of level concurrently and sends them on
+// the returned channel, in no particular order, which is closed when they
+// are done. Decoding stops at the first error, or when ctx is cancelled,
+// and the error is then sent on the error channel, which is closed after
+// the tiles one. Tiles are only decoded as fast as they are received, so
+// memory use stays bounded.
+func (r *Reader) StreamTiles(ctx context.Context, level int) (<-chan DecodedTile, <-chan error) {
+	workers := runtime.NumCPU()
+	// A buffer is not safe for concurrent reads.
+	if _, buffered := r.d.ra.(*buffer); buffered {
+		workers = 1
+	}
+	tiles := make(chan DecodedTile, workers)
+	errc := make(chan error, 1)
+
+	var rects []image.Rectangle
+	err := r.d.checkLevel(level)
+	if err == nil {
+		rects, err = r.d.tileRects(level)
+	}
+	if err != nil {
+		close(tiles)
+		errc <- err
+		close(errc)
+		return tiles, errc
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			errc <- err
+			cancel()
+		})
+	}
+
+	jobs := make(chan image.Rectangle)
+	go func() {
+		defer close(jobs)
+		for _, rect := range rects {
+			select {
+			case jobs <- rect:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	d := r.d.perTile()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rect := range jobs {
+				img, err := decodeLevelSubImage(d, level, rect, 1, -1)
+				if err != nil {
+					fail(err)
+					return
+				}
+				select {
+				case tiles <- DecodedTile{Rect: rect, Image: img}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			fail(err)
+		}
+		cancel()
+		close(tiles)
+		close(errc)
+	}()
+
+	return tiles, errc
+}
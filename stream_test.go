@@ -0,0 +1,36 @@
+package gocog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStreamTilesCancel(t *testing.T) {
+	// 64 by 64 tiles, far more than the workers and the channel hold.
+	r, err := NewReader(bytes.NewReader(tiledTIFF(1024, 1024, 16, 16)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tiles, errc := r.StreamTiles(ctx, 0)
+
+	n := 0
+	for tile := range tiles {
+		if n == 0 {
+			checkSamples(t, tile.Image, 1, testSample)
+		}
+		n++
+		if n == 2 {
+			cancel()
+		}
+	}
+	if n == 64*64 {
+		t.Fatal("streamed every tile despite the cancellation")
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+}
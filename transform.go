@@ -0,0 +1,21 @@
+package gocog
+
+import "math"
+
+// sampleTransform returns Options.SampleTransform, or nil if not set.
+func (d *decoder) sampleTransform() func(float64) float64 {
+	if d.opts == nil {
+		return nil
+	}
+	return d.opts.SampleTransform
+}
+
+// transformSample applies fn to the integer sample v, rounding the result
+// to the nearest integer in [min, max]. NaN results give 0.
+func transformSample(fn func(float64) float64, v, min, max float64) float64 {
+	r := fn(v)
+	if math.IsNaN(r) {
+		return 0
+	}
+	return clamp(math.Round(r), min, max)
+}
@@ -0,0 +1,157 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/terrascope/scimage"
+)
+
+// VerifyOverview checks that the overview at level is consistent with the
+// level above it. It decodes up to sampleTiles tiles spread over the
+// overview and compares each pixel with the mean of the block of pixels it
+// covers at level-1, returning the largest absolute difference found. A
+// correctly averaged pyramid gives differences of at most 0.5 from rounding,
+// other resampling methods give larger but still small ones.
+func (r *Reader) VerifyOverview(level int, sampleTiles int) (maxDiff float64, err error) {
+	if err := r.d.checkLevel(level); err != nil {
+		return 0, err
+	}
+	if level == 0 {
+		return 0, fmt.Errorf("level 0 is not an overview")
+	}
+	if sampleTiles < 1 {
+		return 0, fmt.Errorf("number of sample tiles %d must be positive", sampleTiles)
+	}
+
+	d := r.d
+	if d.opts != nil {
+		opts := *d.opts
+		opts.FullLevel, opts.AutoRange, opts.TileAligned = false, false, false
+		d.opts = &opts
+	}
+
+	cfg, fine := d.gt.Overviews[level], d.gt.Overviews[level-1]
+	if cfg.ImageWidth == 0 || cfg.TileWidth == 0 || cfg.TileHeight == 0 {
+		return 0, FormatError("unexpected image dimensions")
+	}
+	f := int(math.Round(float64(fine.ImageWidth) / float64(cfg.ImageWidth)))
+	if f < 1 {
+		return 0, fmt.Errorf("level %d is not smaller than level %d", level, level-1)
+	}
+	fineBounds := image.Rect(0, 0, int(fine.ImageWidth), int(fine.ImageHeight))
+
+	across := ceilDiv(int(cfg.ImageWidth), int(cfg.TileWidth))
+	down := ceilDiv(int(cfg.ImageHeight), int(cfg.TileHeight))
+	total := across * down
+	if sampleTiles > total {
+		sampleTiles = total
+	}
+
+	for k := 0; k < sampleTiles; k++ {
+		tile := k * total / sampleTiles
+		x, y := (tile%across)*int(cfg.TileWidth), (tile/across)*int(cfg.TileHeight)
+		rect := image.Rect(x, y, x+int(cfg.TileWidth), y+int(cfg.TileHeight))
+
+		ovr, err := decodeLevelSubImage(d, level, rect, 1, -1)
+		if err != nil {
+			return 0, err
+		}
+		rect = ovr.Bounds()
+		src, err := decodeLevelSubImage(d, level-1, image.Rectangle{rect.Min.Mul(f), rect.Max.Mul(f)}.Intersect(fineBounds), 1, -1)
+		if err != nil {
+			return 0, err
+		}
+		ovrAt, err := sampleAt(ovr)
+		if err != nil {
+			return 0, err
+		}
+		srcAt, err := sampleAt(src)
+		if err != nil {
+			return 0, err
+		}
+
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				blk := image.Rect(x*f, y*f, (x+1)*f, (y+1)*f).Intersect(src.Bounds())
+				if blk.Empty() {
+					continue
+				}
+				sum := 0.0
+				for v := blk.Min.Y; v < blk.Max.Y; v++ {
+					for u := blk.Min.X; u < blk.Max.X; u++ {
+						sum += srcAt(u, v)
+					}
+				}
+				mean := sum / float64(blk.Dx()*blk.Dy())
+				maxDiff = math.Max(maxDiff, math.Abs(ovrAt(x, y)-mean))
+			}
+		}
+	}
+
+	return maxDiff, nil
+}
+
+// sampleAt returns a function giving the sample value of img at x, y.
+func sampleAt(img image.Image) (func(x, y int) float64, error) {
+	switch img := img.(type) {
+	case *scimage.GrayU8:
+		return func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }, nil
+	case *scimage.GrayS8:
+		return func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }, nil
+	case *scimage.GrayU16:
+		return func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }, nil
+	case *scimage.GrayS16:
+		return func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)]) }, nil
+	case *GrayF64Image:
+		return func(x, y int) float64 { return img.Pix[img.PixOffset(x, y)] }, nil
+	}
+	return nil, UnsupportedError(fmt.Sprintf("sample access of %T", img))
+}
+
+// VerifyLevel checks that every tile of level, in every plane, can be read
+// and decompresses to enough bytes for the pixels it covers, without
+// decoding the pixels themselves. It is much cheaper than decoding the
+// level when sweeping an archive for corrupt files. Tiles decompressing to
+// too many bytes fail the check if Options.StrictTileSize is set. The
+// layout of the tiles in the file is checked first, with CheckTileLayout.
+func (r *Reader) VerifyLevel(level int) error {
+	if _, err := r.CheckTileLayout(level); err != nil {
+		return err
+	}
+	cfg := r.d.gt.Overviews[level]
+	if cfg.ImageWidth == 0 || cfg.ImageHeight == 0 || cfg.TileWidth == 0 || cfg.TileHeight == 0 {
+		return FormatError("unexpected image dimensions")
+	}
+	if len(cfg.BitsPerSample) == 0 || cfg.BitsPerSample[0] == 0 {
+		return FormatError("BitsPerSample must not be 0")
+	}
+
+	th := int(cfg.TileHeight)
+	across := ceilDiv(int(cfg.ImageWidth), int(cfg.TileWidth))
+	down := ceilDiv(int(cfg.ImageHeight), th)
+	planes := 1
+	if cfg.PlanarConfig == 2 && cfg.SamplesPerPixel > 1 {
+		planes = int(cfg.SamplesPerPixel)
+	}
+	rowBytes := cfg.tileSize() / th
+
+	d := r.d
+	for tile := 0; tile < across*down*planes; tile++ {
+		offset, n, err := cfg.tileLocation(tile)
+		if err != nil {
+			return err
+		}
+		if err = d.readTile(cfg, d.ra, tile, offset, n); err != nil {
+			return fmt.Errorf("tile %d: %w", tile, err)
+		}
+		// The padding rows below the image need not be stored.
+		j := tile % (across * down) / across
+		rows := minInt(th, int(cfg.ImageHeight)-j*th)
+		if len(d.buf) < rows*rowBytes {
+			return FormatError(fmt.Sprintf("tile %d: decompressed to %d bytes, expected %d", tile, len(d.buf), rows*rowBytes))
+		}
+	}
+	return nil
+}
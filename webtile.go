@@ -0,0 +1,146 @@
+package gocog
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// WebTileSize is the width and height in pixels of the tiles returned by
+// WebTile.
+const WebTileSize = 256
+
+// earthRadius is the radius of the sphere of the web mercator projection.
+const earthRadius = 6378137
+
+// WebTile returns the web mercator (EPSG:3857) tile z/x/y of a slippy map,
+// WebTileSize pixels wide and high. The tile is sampled by nearest
+// neighbour from the coarsest level whose pixels are no larger than those
+// of the tile. Only files in web mercator or in WGS 84 geographic
+// coordinates are supported. Pixels outside the image are set to the
+// nodata value of the file, or to zero.
+func (r *Reader) WebTile(z, x, y int) (image.Image, error) {
+	if z < 0 || z > 30 || x < 0 || y < 0 || x >= 1<<uint(z) || y >= 1<<uint(z) {
+		return nil, fmt.Errorf("tile %d/%d/%d does not exist", z, x, y)
+	}
+	geo, err := r.GeoData(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// toSource converts web mercator coordinates to those of the file, in
+	// which res is the size of the pixels of the tile.
+	var toSource func(mx, my float64) (float64, float64)
+	var res float64
+	switch {
+	case geo.ProjCSTType == EPSG3857:
+		toSource = func(mx, my float64) (float64, float64) { return mx, my }
+		res = 2 * math.Pi * earthRadius / (WebTileSize * math.Ldexp(1, z))
+	case geo.ModelType == Geographic && geo.GeographicType == GCS_WGS84:
+		toSource = func(mx, my float64) (float64, float64) {
+			return mx / earthRadius * 180 / math.Pi, math.Atan(math.Sinh(my/earthRadius)) * 180 / math.Pi
+		}
+		res = 360 / (WebTileSize * math.Ldexp(1, z))
+	default:
+		return nil, UnsupportedError("web tiles of files not in EPSG:3857 or WGS 84 coordinates")
+	}
+
+	level, gt, err := r.webTileLevel(res)
+	if err != nil {
+		return nil, err
+	}
+	cfg := r.d.gt.Overviews[level]
+
+	// The tile in web mercator coordinates, and its pixel size.
+	half := math.Pi * earthRadius
+	span := 2 * half / math.Ldexp(1, z)
+	minX, maxY := -half+float64(x)*span, half-float64(y)*span
+	step := span / WebTileSize
+
+	// The pixels of the level covered by the tile.
+	var win image.Rectangle
+	for k, c := range [][2]float64{{minX, maxY}, {minX + span, maxY}, {minX, maxY - span}, {minX + span, maxY - span}} {
+		px, py, err := gt.Inverse(toSource(c[0], c[1]))
+		if err != nil {
+			return nil, err
+		}
+		p := image.Rect(int(math.Floor(px))-1, int(math.Floor(py))-1, int(math.Ceil(px))+1, int(math.Ceil(py))+1)
+		if k == 0 {
+			win = p
+		} else {
+			win = win.Union(p)
+		}
+	}
+	win = win.Intersect(image.Rect(0, 0, int(cfg.ImageWidth), int(cfg.ImageHeight)))
+
+	model := r.d.colorModel(level)
+	var src image.Image
+	if !win.Empty() {
+		if src, err = decodeLevelSubImage(r.d.perTile(), level, win, 1, -1); err != nil {
+			return nil, err
+		}
+		model = src.ColorModel()
+	}
+	tile, err := newImage(model, image.Rect(0, 0, WebTileSize, WebTileSize))
+	if err != nil {
+		return nil, err
+	}
+	if r.d.gt.hasNoData {
+		fillImage(tile, r.d.gt.NoData)
+	}
+	if src == nil {
+		return tile, nil
+	}
+
+	at, err := sampleAt(src)
+	if err != nil {
+		return nil, err
+	}
+	set, err := sampleSetter(tile)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	for j := 0; j < WebTileSize; j++ {
+		for i := 0; i < WebTileSize; i++ {
+			sx, sy := toSource(minX+(float64(i)+0.5)*step, maxY-(float64(j)+0.5)*step)
+			px, py, _ := gt.Inverse(sx, sy)
+			p := image.Pt(int(math.Floor(px)), int(math.Floor(py)))
+			if p.In(b) {
+				set(i, j, at(p.X, p.Y))
+			}
+		}
+	}
+	return tile, nil
+}
+
+// webTileLevel returns the coarsest image level whose pixels are no larger
+// than res, in the units of the CRS of the file, or the finest one if they
+// all are, along with its geotransform.
+func (r *Reader) webTileLevel(res float64) (int, Geotransform, error) {
+	level, size := -1, 0.0
+	var gt Geotransform
+	for k, cfg := range r.d.gt.Overviews {
+		if cfg.NewSubfileType&sfMask != 0 {
+			continue
+		}
+		g, err := r.Geotransform(k)
+		if err != nil {
+			return 0, Geotransform{}, err
+		}
+		// Allow for rounding in the pixel sizes of matching pyramids.
+		s, limit := math.Hypot(g[1], g[4]), res*(1+1e-9)
+		switch {
+		case level < 0:
+		case s <= limit && (size > limit || s > size):
+		case s > limit && size > limit && s < size:
+		default:
+			continue
+		}
+		level, size, gt = k, s, g
+	}
+	if level < 0 {
+		return 0, Geotransform{}, fmt.Errorf("no image level")
+	}
+	return level, gt, nil
+}
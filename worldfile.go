@@ -0,0 +1,24 @@
+package gocog
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteWorldFile writes the ESRI world file (.tfw) of level to w: the six
+// lines holding the pixel size along x, the two rotation terms, the pixel
+// size along y and the coordinates of the centre of the top-left pixel,
+// which world files use as their origin.
+func (r *Reader) WriteWorldFile(level int, w io.Writer) error {
+	gt, err := r.Geotransform(level)
+	if err != nil {
+		return err
+	}
+	x, y := gt.Forward(0.5, 0.5)
+	for _, v := range []float64{gt[1], gt[4], gt[2], gt[5], x, y} {
+		if _, err := fmt.Fprintf(w, "%.10f\n", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
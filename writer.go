@@ -0,0 +1,382 @@
+package gocog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// defaultTileSize is the width and height of the tiles written by Encode
+// when EncodeOptions.TileSize is zero.
+const defaultTileSize = 256
+
+// EncodeOptions are the encoding parameters.
+type EncodeOptions struct {
+	// TileSize is the width and height of the tiles Encode writes, a
+	// multiple of 16 as the spec requires. If zero, tiles are 256 pixels
+	// wide.
+	TileSize int
+
+	// Compression is the compression of the tiles Encode writes, either
+	// CompressionNone or CompressionDeflate. If zero, tiles are written
+	// uncompressed.
+	Compression uint16
+
+	// Overviews is the number of overviews Encode computes, each half the
+	// size of the previous level, and writes after the full resolution
+	// image, as in a COG. OverviewWorkers is passed on to BuildOverviews.
+	Overviews       int
+	OverviewWorkers int
+
+	// Geotransform and GeoKeys, if set, georeference the image Encode
+	// writes. GeoKeys hold their value in ValueOffset, as the keys naming
+	// an EPSG code do, with a TIFFTagLocation of zero, or point into
+	// GeoDoubleParams or GeoAsciiParams, as in a GeoKeyDirectory: with a
+	// TIFFTagLocation of GeoDoubleParamsTag or GeoAsciiParamsTag and the
+	// index of their first value in ValueOffset. The strings of
+	// GeoAsciiParams end with a '|'.
+	Geotransform    *Geotransform
+	GeoKeys         []KeyEntry
+	GeoDoubleParams []float64
+	GeoAsciiParams  string
+}
+
+// An ifdEntry is a tag of an IFD being encoded, with its values.
+type ifdEntry struct {
+	tag      uint16
+	datatype uint16
+	data     []uint32  // For dtShort and dtLong.
+	floats   []float64 // For dtFloat64.
+	ascii    []byte    // For dtASCII, NUL terminated.
+}
+
+// count returns the number of values of e.
+func (e ifdEntry) count() int {
+	switch e.datatype {
+	case dtFloat64:
+		return len(e.floats)
+	case dtASCII:
+		return len(e.ascii)
+	}
+	return len(e.data)
+}
+
+// putValues writes the values of e to b, in little-endian order.
+func (e ifdEntry) putValues(b []byte) {
+	switch e.datatype {
+	case dtShort:
+		for i, v := range e.data {
+			binary.LittleEndian.PutUint16(b[2*i:], uint16(v))
+		}
+	case dtLong:
+		for i, v := range e.data {
+			binary.LittleEndian.PutUint32(b[4*i:], v)
+		}
+	case dtFloat64:
+		for i, v := range e.floats {
+			binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(v))
+		}
+	case dtASCII:
+		copy(b, e.ascii)
+	}
+}
+
+// Encode writes img to w as a little-endian tiled TIFF, georeferenced if
+// opts says so. It handles the gray images of scimage and GrayF64Image,
+// writing a single IFD for the full resolution image followed by one per
+// overview, if any are requested. As in a COG, all the IFDs precede the
+// tile data. A nil opts writes uncompressed tiles of 256x256 pixels.
+func Encode(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	var o EncodeOptions
+	if opts != nil {
+		o = *opts
+	}
+	ts := o.TileSize
+	if ts == 0 {
+		ts = defaultTileSize
+	}
+	if ts < 0 || ts%16 != 0 {
+		return fmt.Errorf("tile size %d must be a positive multiple of 16", ts)
+	}
+	switch o.Compression {
+	case 0:
+		o.Compression = cNone
+	case cNone, cDeflate:
+	default:
+		return UnsupportedError(fmt.Sprintf("encoding with compression %d", o.Compression))
+	}
+	if img.Bounds().Empty() {
+		return fmt.Errorf("empty image")
+	}
+	for _, k := range o.GeoKeys {
+		n := 0
+		switch k.TIFFTagLocation {
+		case 0:
+			continue
+		case GeoDoubleParamsTag:
+			n = len(o.GeoDoubleParams)
+		case GeoAsciiParamsTag:
+			n = len(o.GeoAsciiParams)
+		default:
+			return UnsupportedError(fmt.Sprintf("encoding %s stored in tag %d", GeoKeyName(k.KeyID), k.TIFFTagLocation))
+		}
+		if int(k.ValueOffset)+int(k.Count) > n {
+			return fmt.Errorf("%s: values at %d beyond the %d of tag %d", GeoKeyName(k.KeyID), k.ValueOffset, n, k.TIFFTagLocation)
+		}
+	}
+
+	m := img.ColorModel()
+	size, format := sampleSize(m), sampleFormatOf(m)
+	if size == 0 || format == 0 {
+		return UnsupportedError(fmt.Sprintf("encoding of %T images", img))
+	}
+	levels, err := BuildOverviews(img, o.Overviews, &Options{OverviewWorkers: o.OverviewWorkers})
+	if err != nil {
+		return err
+	}
+	levels = append([]image.Image{img}, levels...)
+
+	// Tiles are compressed up front, as their sizes go in the IFDs.
+	tiles := make([][][]byte, len(levels))
+	for k, level := range levels {
+		if tiles[k], err = tileData(level, ts, ts); err != nil {
+			return err
+		}
+		if o.Compression == cDeflate {
+			for i, t := range tiles[k] {
+				if tiles[k][i], err = deflateTile(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ifds := make([][]ifdEntry, len(levels))
+	for k, level := range levels {
+		b := level.Bounds()
+		n := len(tiles[k])
+		ifds[k] = []ifdEntry{
+			{tag: cImageWidth, datatype: dtLong, data: []uint32{uint32(b.Dx())}},
+			{tag: cImageLength, datatype: dtLong, data: []uint32{uint32(b.Dy())}},
+			{tag: cBitsPerSample, datatype: dtShort, data: []uint32{uint32(8 * size)}},
+			{tag: cCompression, datatype: dtShort, data: []uint32{uint32(o.Compression)}},
+			{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{pBlackIsZero}},
+			{tag: cSamplesPerPixel, datatype: dtShort, data: []uint32{1}},
+			{tag: cPlanarConfiguration, datatype: dtShort, data: []uint32{1}},
+			{tag: cTileWidth, datatype: dtLong, data: []uint32{uint32(ts)}},
+			{tag: cTileLength, datatype: dtLong, data: []uint32{uint32(ts)}},
+			{tag: cTileOffsets, datatype: dtLong, data: make([]uint32, n)},
+			{tag: cTileByteCounts, datatype: dtLong, data: make([]uint32, n)},
+			{tag: cSampleFormat, datatype: dtShort, data: []uint32{uint32(format)}},
+		}
+		if k > 0 {
+			ifds[k] = append(ifds[k], ifdEntry{tag: cNewSubfileType, datatype: dtLong, data: []uint32{sfReducedImage}})
+		} else {
+			ifds[k] = append(ifds[k], geoEntries(&o)...)
+		}
+		sort.Slice(ifds[k], func(i, j int) bool { return ifds[k][i].tag < ifds[k][j].tag })
+	}
+
+	// Lay out the IFDs, each followed by the values too large to fit in
+	// its entries, then the tiles.
+	offset := int64(8)
+	ifdOffsets := make([]int64, len(ifds))
+	for k, ents := range ifds {
+		ifdOffsets[k] = offset
+		offset += ifdSize(ents)
+	}
+	for k, ents := range ifds {
+		for _, e := range ents {
+			switch e.tag {
+			case cTileOffsets:
+				for i, t := range tiles[k] {
+					e.data[i] = uint32(offset)
+					offset += int64(len(t))
+				}
+			case cTileByteCounts:
+				for i, t := range tiles[k] {
+					e.data[i] = uint32(len(t))
+				}
+			}
+		}
+	}
+	if offset > math.MaxUint32 {
+		return UnsupportedError(fmt.Sprintf("encoding files of %d bytes, beyond the 4 GiB of classic TIFF", offset))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(leHeader)
+	binary.Write(&buf, binary.LittleEndian, uint32(ifdOffsets[0]))
+	for k, ents := range ifds {
+		next := int64(0)
+		if k+1 < len(ifds) {
+			next = ifdOffsets[k+1]
+		}
+		buf.Write(encodeIFD(ents, ifdOffsets[k], next))
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	for _, level := range tiles {
+		for _, t := range level {
+			if _, err := w.Write(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ifdSize returns the number of bytes encodeIFD writes for ents.
+func ifdSize(ents []ifdEntry) int64 {
+	n := int64(2 + ifdLen*len(ents) + 4)
+	for _, e := range ents {
+		if l := int64(lengths[e.datatype]) * int64(e.count()); l > 4 {
+			n += l + l%2
+		}
+	}
+	return n
+}
+
+// encodeIFD returns the IFD made of ents, to be written at offset, with the
+// values that do not fit in the entries following it. next is the offset
+// of the next IFD.
+func encodeIFD(ents []ifdEntry, offset, next int64) []byte {
+	head := make([]byte, 2+ifdLen*len(ents)+4)
+	binary.LittleEndian.PutUint16(head, uint16(len(ents)))
+	var ext []byte
+	extOffset := offset + int64(len(head))
+	for i, e := range ents {
+		p := head[2+ifdLen*i:]
+		binary.LittleEndian.PutUint16(p[0:2], e.tag)
+		binary.LittleEndian.PutUint16(p[2:4], e.datatype)
+		binary.LittleEndian.PutUint32(p[4:8], uint32(e.count()))
+		val := make([]byte, int(lengths[e.datatype])*e.count())
+		e.putValues(val)
+		if len(val) <= 4 {
+			copy(p[8:12], val)
+			continue
+		}
+		// Values start on a word boundary, as the spec requires.
+		binary.LittleEndian.PutUint32(p[8:12], uint32(extOffset+int64(len(ext))))
+		ext = append(ext, val...)
+		if len(val)%2 != 0 {
+			ext = append(ext, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(head[len(head)-4:], uint32(next))
+	return append(head, ext...)
+}
+
+// geoEntries returns the GeoTIFF tags describing the Geotransform and
+// GeoKeys of o, if set. Geotransforms without rotation are written as a
+// tiepoint and pixel scale, as most readers expect, and others as a
+// ModelTransformation.
+func geoEntries(o *EncodeOptions) []ifdEntry {
+	gt, keys := o.Geotransform, o.GeoKeys
+	var ents []ifdEntry
+	if gt != nil {
+		g := *gt
+		if g[2] == 0 && g[4] == 0 {
+			ents = append(ents,
+				ifdEntry{tag: tModelPixelScale, datatype: dtFloat64, floats: []float64{g[1], -g[5], 0}},
+				ifdEntry{tag: tModelTiepoint, datatype: dtFloat64, floats: []float64{0, 0, 0, g[0], g[3], 0}})
+		} else {
+			ents = append(ents, ifdEntry{tag: tModelTransformation, datatype: dtFloat64, floats: []float64{
+				g[1], g[2], 0, g[0],
+				g[4], g[5], 0, g[3],
+				0, 0, 0, 0,
+				0, 0, 0, 1,
+			}})
+		}
+	}
+	if len(keys) > 0 {
+		dir := geoKeyDirectory(keys)
+		data := make([]uint32, len(dir))
+		for i, v := range dir {
+			data[i] = uint32(v)
+		}
+		ents = append(ents, ifdEntry{tag: tGeoKeyDirectory, datatype: dtShort, data: data})
+		if len(o.GeoDoubleParams) > 0 {
+			ents = append(ents, ifdEntry{tag: GeoDoubleParamsTag, datatype: dtFloat64, floats: o.GeoDoubleParams})
+		}
+		if o.GeoAsciiParams != "" {
+			ents = append(ents, ifdEntry{tag: GeoAsciiParamsTag, datatype: dtASCII, ascii: append([]byte(o.GeoAsciiParams), 0)})
+		}
+	}
+	return ents
+}
+
+// deflateTile compresses a tile with zlib, as Compression 8 requires.
+func deflateTile(t []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(t); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tileData cuts img into tiles of tw by th pixels, in row-major order,
+// returning the uncompressed little-endian samples of each. Whatever the
+// layout img was decoded from, the tiles follow the grid anchored at its
+// top-left corner, and those on the right and bottom edges are padded to
+// the full tile size with zeros.
+func tileData(img image.Image, tw, th int) ([][]byte, error) {
+	if tw <= 0 || th <= 0 {
+		return nil, fmt.Errorf("tile size %dx%d must be positive", tw, th)
+	}
+	size := sampleSize(img.ColorModel())
+	if size == 0 {
+		return nil, UnsupportedError(fmt.Sprintf("encoding of %T images", img))
+	}
+	at, err := sampleAt(img)
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	across, down := ceilDiv(b.Dx(), tw), ceilDiv(b.Dy(), th)
+	tiles := make([][]byte, 0, across*down)
+	for j := 0; j < down; j++ {
+		for i := 0; i < across; i++ {
+			tile := make([]byte, tw*th*size)
+			r := image.Rect(i*tw, j*th, (i+1)*tw, (j+1)*th).Add(b.Min).Intersect(b)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				row := tile[(y-b.Min.Y-j*th)*tw*size:]
+				for x := r.Min.X; x < r.Max.X; x++ {
+					putSample(img.ColorModel(), row[(x-b.Min.X-i*tw)*size:], at(x, y))
+				}
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	return tiles, nil
+}
+
+// sampleFormatOf returns the SampleFormat tag value describing the samples
+// tileData writes for images of model m: 1 for unsigned integers, 2 for
+// two's complement signed ones and 3 for IEEE floating point, or 0 if m
+// cannot be encoded.
+func sampleFormatOf(m color.Model) uint16 {
+	switch m.(type) {
+	case scicolor.GrayU8Model, scicolor.GrayU16Model:
+		return uint16(uintSample)
+	case scicolor.GrayS8Model, scicolor.GrayS16Model:
+		return uint16(sintSample)
+	case GrayF64Model:
+		return uint16(ieeefpSample)
+	}
+	return 0
+}
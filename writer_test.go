@@ -0,0 +1,238 @@
+package gocog
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/terrascope/scimage/scicolor"
+)
+
+// testImage returns an image of model m with bounds r whose samples are
+// given by f.
+func testImage(t *testing.T, m color.Model, r image.Rectangle, f func(x, y int) float64) image.Image {
+	t.Helper()
+	img, err := newImage(m, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := sampleSetter(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			set(x, y, f(x, y))
+		}
+	}
+	return img
+}
+
+// encodeAndRead encodes img with opts and opens the result.
+func encodeAndRead(t *testing.T, img image.Image, opts *EncodeOptions) *Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, opts); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// checkSameSamples checks that got holds the samples of want, which has
+// its origin at (0, 0).
+func checkSameSamples(t *testing.T, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds %v, want %v", got.Bounds(), want.Bounds())
+	}
+	gat, err := sampleAt(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wat, err := sampleAt(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if g, w := gat(x, y), wat(x, y); g != w {
+				t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	models := []color.Model{
+		scicolor.GrayU8Model{Min: 0, Max: 0xff},
+		scicolor.GrayU16Model{Min: 0, Max: 0xffff},
+		GrayF64Model{Min: 0, Max: 1000},
+	}
+	for _, m := range models {
+		for _, compression := range []uint16{cNone, cDeflate} {
+			img := testImage(t, m, image.Rect(0, 0, 70, 45), func(x, y int) float64 {
+				return float64((7*x + 13*y) % 251)
+			})
+			r := encodeAndRead(t, img, &EncodeOptions{TileSize: 32, Compression: compression, Overviews: 1})
+			if n := r.NumLevels(); n != 2 {
+				t.Fatalf("%T, compression %d: %d levels, want 2", m, compression, n)
+			}
+			got, err := r.DecodeLevel(0)
+			if err != nil {
+				t.Fatalf("%T, compression %d: %v", m, compression, err)
+			}
+			checkSameSamples(t, got, img)
+		}
+	}
+}
+
+// sinusoidalKeys returns the GeoKeys of a sinusoidal projection in metres,
+// for rasters of the given GTRasterTypeGeoKey. All their values are SHORT.
+func sinusoidalKeys(rasterType uint16) []KeyEntry {
+	return []KeyEntry{
+		{KeyID: GTModelTypeGeoKey, Count: 1, ValueOffset: 1},
+		{KeyID: GTRasterTypeGeoKey, Count: 1, ValueOffset: rasterType},
+		{KeyID: GeogAngularUnitsGeoKey, Count: 1, ValueOffset: 9102},
+		{KeyID: ProjCoordTransGeoKey, Count: 1, ValueOffset: 24},
+		{KeyID: ProjLinearUnitsGeoKey, Count: 1, ValueOffset: 9001},
+	}
+}
+
+func TestEncodeGeoKeys(t *testing.T) {
+	img := testImage(t, scicolor.GrayU8Model{Min: 0, Max: 0xff}, image.Rect(0, 0, 20, 10), func(x, y int) float64 { return 1 })
+	gt := Geotransform{-1e6, 250, 0, 5e6, 0, -250}
+	r := encodeAndRead(t, img, &EncodeOptions{Geotransform: &gt, GeoKeys: sinusoidalKeys(1)})
+
+	if got, err := r.Geotransform(0); err != nil || got != gt {
+		t.Fatalf("geotransform %v, %v, want %v", got, err, gt)
+	}
+	gd, err := r.GeoData(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gd.ModelType != Projected || gd.ProjCoordTrans != CTSinusoidal {
+		t.Fatalf("GeoData %+v", gd)
+	}
+	if _, err := r.WKT(0); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := r.Proj4(0); err != nil || !strings.Contains(p, "+proj=sinu") {
+		t.Fatalf("Proj4 %q, %v", p, err)
+	}
+}
+
+func TestEncodeGeoParams(t *testing.T) {
+	img := testImage(t, scicolor.GrayU8Model{Min: 0, Max: 0xff}, image.Rect(0, 0, 20, 10), func(x, y int) float64 { return 1 })
+	gt := Geotransform{-1e6, 250, 0, 5e6, 0, -250}
+	keys := append(sinusoidalKeys(1),
+		KeyEntry{KeyID: GTCitationGeoKey, TIFFTagLocation: GeoAsciiParamsTag, Count: 10, ValueOffset: 0},
+		KeyEntry{KeyID: ProjFalseEastingGeoKey, TIFFTagLocation: GeoDoubleParamsTag, Count: 1, ValueOffset: 0},
+		KeyEntry{KeyID: ProjFalseNorthingGeoKey, TIFFTagLocation: GeoDoubleParamsTag, Count: 1, ValueOffset: 1},
+	)
+	r := encodeAndRead(t, img, &EncodeOptions{
+		Geotransform:    &gt,
+		GeoKeys:         keys,
+		GeoDoubleParams: []float64{500000, 1e7},
+		GeoAsciiParams:  "Sinusoidal|",
+	})
+
+	gd, err := r.GeoData(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gd.Citation != "Sinusoidal" || gd.ProjFalseEasting != 500000 || gd.ProjFalseNorthing != 1e7 {
+		t.Fatalf("GeoData %+v", gd)
+	}
+	if p, err := r.Proj4(0); err != nil || !strings.Contains(p, "+x_0=500000") {
+		t.Fatalf("Proj4 %q, %v", p, err)
+	}
+
+	// Keys pointing past the end of their parameters are rejected.
+	keys[len(keys)-1].ValueOffset = 2
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, &EncodeOptions{GeoKeys: keys, GeoDoubleParams: []float64{500000, 1e7}, GeoAsciiParams: "Sinusoidal|"}); err == nil {
+		t.Fatal("encoded a key beyond GeoDoubleParams")
+	}
+}
+
+func TestEncodeSignedRoundTrip(t *testing.T) {
+	models := []color.Model{
+		scicolor.GrayS8Model{Min: -128, Max: 127},
+		scicolor.GrayS16Model{Min: -32768, Max: 32767},
+	}
+	for _, m := range models {
+		max := 127.0
+		if _, ok := m.(scicolor.GrayS16Model); ok {
+			max = 32767
+		}
+		img := testImage(t, m, image.Rect(0, 0, 40, 30), func(x, y int) float64 {
+			return math.Round(max * math.Sin(float64(x*30+y)))
+		})
+		r := encodeAndRead(t, img, &EncodeOptions{TileSize: 16})
+		if f := r.d.gt.Overviews[0].SampleFormat; len(f) == 0 || sampleFormat(f[0]) != sintSample {
+			t.Fatalf("%T: SampleFormat %v, want signed integers", m, f)
+		}
+		got, err := r.DecodeLevel(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameSamples(t, got, img)
+	}
+}
+
+func TestTileDataPadsEdgeTiles(t *testing.T) {
+	img := testImage(t, scicolor.GrayU8Model{Min: 0, Max: 0xff}, image.Rect(3, 2, 40, 25), func(x, y int) float64 {
+		return float64(testSample(x, y)) + 1
+	})
+	tiles, err := tileData(img, 16, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 37 by 23 pixels make 3 by 3 tiles.
+	if len(tiles) != 9 {
+		t.Fatalf("%d tiles, want 9", len(tiles))
+	}
+	for k, tile := range tiles {
+		i, j := k%3, k/3
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 16; x++ {
+				ix, iy := 3+16*i+x, 2+8*j+y
+				want := uint8(0)
+				if ix < 40 && iy < 25 {
+					want = testSample(ix, iy) + 1
+				}
+				if got := tile[16*y+x]; got != want {
+					t.Fatalf("tile %d, pixel (%d, %d): got %d, want %d", k, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestRetile(t *testing.T) {
+	// Odd sizes leave partial edge tiles both in the source and once
+	// re-tiled.
+	src, err := DecodeLevel(bytes.NewReader(tiledTIFF(45, 29, 16, 16)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range []int{16, 32, 64} {
+		r := encodeAndRead(t, src, &EncodeOptions{TileSize: ts})
+		if cfg := r.d.gt.Overviews[0]; cfg.TileWidth != uint32(ts) || cfg.TileHeight != uint32(ts) {
+			t.Fatalf("tiles of %dx%d, want %d", cfg.TileWidth, cfg.TileHeight, ts)
+		}
+		got, err := r.DecodeLevel(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameSamples(t, got, src)
+	}
+}
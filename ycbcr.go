@@ -0,0 +1,69 @@
+package gocog
+
+import "image"
+
+// defaultReferenceBlackWhite holds the reference levels of YCbCr images
+// without a ReferenceBlackWhite tag, as assumed by libtiff.
+var defaultReferenceBlackWhite = []float64{0, 255, 128, 255, 128, 255}
+
+// ycbcrToRGB converts an 8-bit YCbCr pixel to RGB as described by the
+// YCbCr section of the spec. The components are first scaled from the
+// reference levels ref, as read from the ReferenceBlackWhite tag or nil
+// for the default ones, to 0-255 for Y and to -127-127 for Cb and Cr, whose
+// reference black is their zero level. They are then converted with the
+// ITU-R BT.601 coefficients.
+func ycbcrToRGB(y, cb, cr uint8, ref []float64) (r, g, b uint8) {
+	if len(ref) < 6 {
+		ref = defaultReferenceBlackWhite
+	}
+	scale := func(v uint8, black, white, span float64) float64 {
+		if white == black {
+			return float64(v)
+		}
+		return (float64(v) - black) * span / (white - black)
+	}
+	fy := scale(y, ref[0], ref[1], 255)
+	fcb := scale(cb, ref[2], ref[3], 127)
+	fcr := scale(cr, ref[4], ref[5], 127)
+
+	to8 := func(v float64) uint8 { return uint8(clamp(v+0.5, 0, 255)) }
+	return to8(fy + 1.402*fcr), to8(fy - 0.344136*fcb - 0.714136*fcr), to8(fy + 1.772*fcb)
+}
+
+// decodeYCbCr decodes the 8-bit YCbCr samples in d.buf into the RGBA or
+// NRGBA image of t. The samples are stored in data units covering blocks of
+// h by v pixels, as given by YCbCrSubSampling, each made of the Y samples
+// of the block in row-major order followed by the Cb and Cr samples they
+// share. Chroma samples are replicated over their block.
+func (d *decoder) decodeYCbCr(t target, cfg ImgDesc, blk image.Rectangle) error {
+	if cfg.Predictor != prNone {
+		return UnsupportedError("predictor with YCbCr samples")
+	}
+	pix, stride, rect, _ := rgbPix(t.img)
+	h, v := int(cfg.YCbCrSubSampling[0]), int(cfg.YCbCrSubSampling[1])
+	unit := h*v + 2
+	across := ceilDiv(blk.Dx(), h)
+	rMaxX := minInt(blk.Max.X, t.clip.Max.X)
+	rMaxY := minInt(blk.Max.Y, t.clip.Max.Y)
+
+	for y := blk.Min.Y; y < rMaxY; y++ {
+		for x := blk.Min.X; x < rMaxX; x++ {
+			if !t.keeps(x, y) {
+				continue
+			}
+			p := image.Pt(x/t.step+t.delta.X, y/t.step+t.delta.Y)
+			if !p.In(rect) {
+				continue
+			}
+			bx, by := x-blk.Min.X, y-blk.Min.Y
+			off := ((by/v)*across + bx/h) * unit
+			if off+unit > len(d.buf) {
+				return errNoPixels
+			}
+			r, g, b := ycbcrToRGB(d.buf[off+(by%v)*h+bx%h], d.buf[off+h*v], d.buf[off+h*v+1], cfg.ReferenceBlackWhite)
+			i := (p.Y-rect.Min.Y)*stride + (p.X-rect.Min.X)*4
+			pix[i], pix[i+1], pix[i+2] = r, g, b
+		}
+	}
+	return nil
+}
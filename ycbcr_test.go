@@ -0,0 +1,89 @@
+package gocog
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// ycbcrTIFF returns a TIFF of 20 by 12 pixels with YCbCr samples
+// subsampled by 2 in both directions, in uncompressed tiles of 16 by 16
+// pixels. Its Y samples are given by testSample and its chroma ones by cb
+// and cr, which take the coordinates of the 2x2 block of a pixel.
+func ycbcrTIFF(cb, cr func(ux, uy int) uint8, ents ...ifdEntry) []byte {
+	const w, h, ts = 20, 12, 16
+	var tiles [][]byte
+	for ty := 0; ty < h; ty += ts {
+		for tx := 0; tx < w; tx += ts {
+			var tile []byte
+			for uy := ty / 2; uy < (ty+ts)/2; uy++ {
+				for ux := tx / 2; ux < (tx+ts)/2; ux++ {
+					for k := 0; k < 4; k++ {
+						tile = append(tile, testSample(2*ux+k%2, 2*uy+k/2))
+					}
+					tile = append(tile, cb(ux, uy), cr(ux, uy))
+				}
+			}
+			tiles = append(tiles, tile)
+		}
+	}
+	return testTIFF(withEntries([]ifdEntry{
+		{tag: cImageWidth, datatype: dtLong, data: []uint32{w}},
+		{tag: cImageLength, datatype: dtLong, data: []uint32{h}},
+		{tag: cBitsPerSample, datatype: dtShort, data: []uint32{8, 8, 8}},
+		{tag: cCompression, datatype: dtShort, data: []uint32{cNone}},
+		{tag: cPhotometricInterpr, datatype: dtShort, data: []uint32{pYCbCr}},
+		{tag: cSamplesPerPixel, datatype: dtShort, data: []uint32{3}},
+		{tag: cTileWidth, datatype: dtLong, data: []uint32{ts}},
+		{tag: cTileLength, datatype: dtLong, data: []uint32{ts}},
+		{tag: cTileOffsets},
+		{tag: cTileByteCounts},
+		{tag: cYCbCrSubSampling, datatype: dtShort, data: []uint32{2, 2}},
+	}, ents), tiles)
+}
+
+func TestDecodeYCbCr(t *testing.T) {
+	// Blocks with a multiple of 3 for ux and an even uy are gray.
+	cb := func(ux, uy int) uint8 { return uint8(128 + ux%3*10) }
+	cr := func(ux, uy int) uint8 { return uint8(128 - uy%2*20) }
+	studio := []float64{16, 235, 128, 240, 128, 240}
+
+	for _, ref := range [][]float64{nil, studio} {
+		var ents []ifdEntry
+		if ref != nil {
+			ents = append(ents, ifdEntry{tag: cReferenceBlackWhite, datatype: dtFloat64, floats: ref})
+		}
+		r, err := NewReader(bytes.NewReader(ycbcrTIFF(cb, cr, ents...)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := r.DecodeLevelSubImage(0, image.Rect(1, 1, 20, 12))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, ok := img.(*image.RGBA)
+		if !ok {
+			t.Fatalf("decoded a %T, want an *image.RGBA", img)
+		}
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl := ycbcrToRGB(testSample(x, y), cb(x/2, y/2), cr(x/2, y/2), ref)
+				if want := (color.RGBA{r, g, bl, 0xff}); m.RGBAAt(x, y) != want {
+					t.Fatalf("pixel (%d, %d): got %v, want %v", x, y, m.RGBAAt(x, y), want)
+				}
+			}
+		}
+
+		// The gray pixel (6, 5) has a Y of 21, which is 6 once scaled from
+		// the studio range.
+		want := color.RGBA{21, 21, 21, 0xff}
+		if ref != nil {
+			want = color.RGBA{6, 6, 6, 0xff}
+		}
+		if got := m.RGBAAt(6, 5); got != want {
+			t.Fatalf("ReferenceBlackWhite %v: gray pixel %v, want %v", ref, got, want)
+		}
+	}
+}